@@ -134,10 +134,14 @@ func (this *KafkaAvroDecoder) Decode(bytes []byte) (interface{}, error) {
 			return nil, errors.New("Unknown magic byte!")
 		}
 		id := int32(binary.BigEndian.Uint32(bytes[1:]))
-		schema, err := this.schemaRegistry.GetByID(id)
+		meta, err := this.schemaRegistry.GetByID(id)
 		if err != nil {
 			return nil, err
 		}
+		if meta.Format != SerializationFormatAvro {
+			return nil, fmt.Errorf("schema %d is a %s schema, not Avro", id, meta.Format)
+		}
+		schema := meta.AvroSchema
 
 		if schema.Type() == avro.Bytes {
 			return bytes[5:], nil
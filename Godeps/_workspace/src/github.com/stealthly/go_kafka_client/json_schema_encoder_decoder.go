@@ -0,0 +1,182 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// KafkaJsonSchemaEncoder encodes arbitrary values as JSON, validating them against a registered JSON
+// Schema document before tagging them with the usual magic byte + 4-byte schema id prefix.
+type KafkaJsonSchemaEncoder struct {
+	schemaRegistry SchemaRegistryClient
+	subject        string
+	rawSchema      string
+	schema         *gojsonschema.Schema
+
+	schemaID     int32
+	schemaIDLock sync.Mutex
+}
+
+// NewKafkaJsonSchemaEncoder returns a KafkaJsonSchemaEncoder validating against rawSchema (a JSON Schema
+// document) and registering it under subject the first time Encode is called.
+func NewKafkaJsonSchemaEncoder(url string, subject string, rawSchema string) (*KafkaJsonSchemaEncoder, error) {
+	schema, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(rawSchema))
+	if err != nil {
+		return nil, err
+	}
+
+	return &KafkaJsonSchemaEncoder{
+		schemaRegistry: NewCachedSchemaRegistryClient(url),
+		subject:        subject,
+		rawSchema:      rawSchema,
+		schema:         schema,
+		schemaID:       -1,
+	}, nil
+}
+
+// Encode marshals obj to JSON, validates it against the registered schema, and prefixes it with the
+// magic byte + schema id.
+func (this *KafkaJsonSchemaEncoder) Encode(obj interface{}) ([]byte, error) {
+	if obj == nil {
+		return nil, nil
+	}
+
+	payload, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := this.schema.Validate(gojsonschema.NewBytesLoader(payload))
+	if err != nil {
+		return nil, err
+	}
+	if !result.Valid() {
+		return nil, fmt.Errorf("value does not conform to schema %s: %v", this.subject, result.Errors())
+	}
+
+	id, err := this.ensureRegistered()
+	if err != nil {
+		return nil, err
+	}
+
+	buffer := &bytes.Buffer{}
+	buffer.Write(magic_bytes)
+	idSlice := make([]byte, 4)
+	binary.BigEndian.PutUint32(idSlice, uint32(id))
+	buffer.Write(idSlice)
+	buffer.Write(payload)
+
+	return buffer.Bytes(), nil
+}
+
+func (this *KafkaJsonSchemaEncoder) ensureRegistered() (int32, error) {
+	this.schemaIDLock.Lock()
+	schemaID := this.schemaID
+	this.schemaIDLock.Unlock()
+	if schemaID >= 0 {
+		return schemaID, nil
+	}
+
+	id, err := this.schemaRegistry.RegisterRaw(this.subject, SerializationFormatJsonSchema, this.rawSchema)
+	if err != nil {
+		return -1, err
+	}
+
+	this.schemaIDLock.Lock()
+	this.schemaID = id
+	this.schemaIDLock.Unlock()
+	return id, nil
+}
+
+// KafkaJsonSchemaDecoder decodes payloads produced by KafkaJsonSchemaEncoder, validating them against the
+// schema the registry has on file for the embedded schema id before unmarshaling.
+type KafkaJsonSchemaDecoder struct {
+	schemaRegistry SchemaRegistryClient
+	schemaCache    map[int32]*gojsonschema.Schema
+	cacheLock      sync.Mutex
+}
+
+// NewKafkaJsonSchemaDecoder returns a KafkaJsonSchemaDecoder resolving schema ids against the registry at url.
+func NewKafkaJsonSchemaDecoder(url string) *KafkaJsonSchemaDecoder {
+	return &KafkaJsonSchemaDecoder{
+		schemaRegistry: NewCachedSchemaRegistryClient(url),
+		schemaCache:    make(map[int32]*gojsonschema.Schema),
+	}
+}
+
+// Decode validates the JSON payload embedded in data against its registered schema and unmarshals it
+// into out.
+func (this *KafkaJsonSchemaDecoder) Decode(data []byte, out interface{}) error {
+	if data == nil {
+		return nil
+	}
+	if data[0] != 0 {
+		return errors.New("Unknown magic byte!")
+	}
+
+	id := int32(binary.BigEndian.Uint32(data[1:5]))
+	payload := data[5:]
+
+	schema, err := this.schemaFor(id)
+	if err != nil {
+		return err
+	}
+
+	result, err := schema.Validate(gojsonschema.NewBytesLoader(payload))
+	if err != nil {
+		return err
+	}
+	if !result.Valid() {
+		return fmt.Errorf("message does not conform to schema %d: %v", id, result.Errors())
+	}
+
+	return json.Unmarshal(payload, out)
+}
+
+func (this *KafkaJsonSchemaDecoder) schemaFor(id int32) (*gojsonschema.Schema, error) {
+	this.cacheLock.Lock()
+	schema, ok := this.schemaCache[id]
+	this.cacheLock.Unlock()
+	if ok {
+		return schema, nil
+	}
+
+	meta, err := this.schemaRegistry.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if meta.Format != SerializationFormatJsonSchema {
+		return nil, fmt.Errorf("schema %d is a %s schema, not JSON Schema", id, meta.Format)
+	}
+
+	schema, err = gojsonschema.NewSchema(gojsonschema.NewStringLoader(meta.RawSchema))
+	if err != nil {
+		return nil, err
+	}
+
+	this.cacheLock.Lock()
+	this.schemaCache[id] = schema
+	this.cacheLock.Unlock()
+	return schema, nil
+}
@@ -16,14 +16,53 @@ limitations under the License. */
 package go_kafka_client
 
 import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"io/ioutil"
+
 	"github.com/Shopify/sarama"
 	"github.com/stealthly/siesta"
 )
 
+// SecurityProtocol identifies how a LowLevelClient connects to brokers: in plaintext, over TLS, or using
+// SASL authentication layered on top of either transport. Mirrors Kafka's own security.protocol values.
+type SecurityProtocol string
+
+const (
+	SecurityProtocolPlaintext     SecurityProtocol = "PLAINTEXT"
+	SecurityProtocolSSL           SecurityProtocol = "SSL"
+	SecurityProtocolSASLPlaintext SecurityProtocol = "SASL_PLAINTEXT"
+	SecurityProtocolSASLSSL       SecurityProtocol = "SASL_SSL"
+)
+
+// SaslMechanism identifies the SASL mechanism a LowLevelClient uses to authenticate once SecurityProtocol
+// is SASL_PLAINTEXT or SASL_SSL.
+type SaslMechanism string
+
+const (
+	SaslMechanismPlain       SaslMechanism = "PLAIN"
+	SaslMechanismScramSHA256 SaslMechanism = "SCRAM-SHA-256"
+	SaslMechanismScramSHA512 SaslMechanism = "SCRAM-SHA-512"
+)
+
+// MessageLabeler, when set, is invoked for every message a LowLevelClient fetches, before it is handed to
+// the user Strategy, so that callers can attach metadata-derived labels (e.g. the Mesos scheduler's YAML
+// scrape config) without this package depending on them. Left nil, fetched messages carry no labels.
+var MessageLabeler func(topic string, partition int32, message *Message)
+
+// applyMessageLabels sets message.Labels via MessageLabeler, if one is configured.
+func applyMessageLabels(topic string, partition int32, message *Message) {
+	if MessageLabeler != nil {
+		MessageLabeler(topic, partition, message)
+	}
+}
+
 // LowLevelClient is a low-level Kafka client that manages broker connections, responsible to fetch metadata and is able
 // to handle Fetch and Offset requests.
-//TODO not sure that's a good name for this interface
+// TODO not sure that's a good name for this interface
 type LowLevelClient interface {
 	// This will be called right after connecting to ConsumerCoordinator so this client can initialize itself
 	// with bootstrap broker list for example. May return an error to signal this client is unable to work with given configuration.
@@ -72,7 +111,12 @@ func (this *SaramaClient) Initialize() error {
 		return err
 	}
 
-	client, err := sarama.NewClient(this.config.Clientid, bootstrapBrokers, nil)
+	saramaConfig := sarama.NewConfig()
+	if err := applySecurityConfig(this.config, saramaConfig); err != nil {
+		return err
+	}
+
+	client, err := sarama.NewClient(this.config.Clientid, bootstrapBrokers, saramaConfig)
 	if err != nil {
 		return err
 	}
@@ -81,9 +125,90 @@ func (this *SaramaClient) Initialize() error {
 	return nil
 }
 
+// applySecurityConfig maps the SASL/TLS settings of a ConsumerConfig onto a sarama.Config so that
+// SaramaClient can authenticate against SASL_PLAINTEXT/SASL_SSL brokers. Does nothing if SecurityProtocol
+// is left at its zero value, preserving the previous plaintext, unauthenticated behavior.
+func applySecurityConfig(config *ConsumerConfig, saramaConfig *sarama.Config) error {
+	switch config.SecurityProtocol {
+	case "", SecurityProtocolPlaintext:
+		return nil
+	case SecurityProtocolSSL:
+		tlsConfig, err := newTLSConfig(config)
+		if err != nil {
+			return err
+		}
+		saramaConfig.Net.TLS.Enable = true
+		saramaConfig.Net.TLS.Config = tlsConfig
+		return nil
+	case SecurityProtocolSASLPlaintext, SecurityProtocolSASLSSL:
+		saramaConfig.Net.SASL.Enable = true
+		saramaConfig.Net.SASL.User = config.SaslUsername
+		saramaConfig.Net.SASL.Password = config.SaslPassword
+		switch config.SaslMechanism {
+		case "", SaslMechanismPlain:
+			saramaConfig.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+		case SaslMechanismScramSHA256:
+			saramaConfig.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+			saramaConfig.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return newScramClient(sha256.New) }
+		case SaslMechanismScramSHA512:
+			saramaConfig.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+			saramaConfig.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return newScramClient(sha512.New) }
+		default:
+			return fmt.Errorf("unsupported SASL mechanism: %s", config.SaslMechanism)
+		}
+
+		if config.SecurityProtocol == SecurityProtocolSASLSSL {
+			tlsConfig, err := newTLSConfig(config)
+			if err != nil {
+				return err
+			}
+			saramaConfig.Net.TLS.Enable = true
+			saramaConfig.Net.TLS.Config = tlsConfig
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported security protocol: %s", config.SecurityProtocol)
+	}
+}
+
+// newTLSConfig builds a *tls.Config from a ConsumerConfig's CAFile/CertFile/KeyFile settings. CertFile and
+// KeyFile are optional and only needed for mutual TLS; CAFile is optional and falls back to the system pool.
+func newTLSConfig(config *ConsumerConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify}
+
+	if config.CAFile != "" {
+		caCert, err := ioutil.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		caCertPool := x509.NewCertPool()
+		if !caCertPool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("unable to parse CA certificate %s", config.CAFile)
+		}
+		tlsConfig.RootCAs = caCertPool
+	}
+
+	if config.CertFile != "" && config.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
 // This will be called each time the fetch request to Kafka should be issued. Topic, partition and offset are self-explanatory.
 // Returns slice of Messages and an error if a fetch error occurred.
 func (this *SaramaClient) Fetch(topic string, partition int32, offset int64) ([]*Message, error) {
+	span := startFetchSpan(this.config, "sarama.fetch", topic, partition, offset)
+	messages, err := this.doFetch(topic, partition, offset)
+	finishFetchSpan(span, messages, err)
+	return messages, err
+}
+
+func (this *SaramaClient) doFetch(topic string, partition int32, offset int64) ([]*Message, error) {
 	leader, err := this.client.Leader(topic, partition)
 	if err != nil {
 		this.client.RefreshTopicMetadata(topic)
@@ -172,22 +297,26 @@ func (this *SaramaClient) collectMessages(partitionData *sarama.FetchResponseBlo
 	for _, message := range partitionData.MsgSet.Messages {
 		if message.Msg.Set != nil {
 			for _, wrapped := range message.Msg.Set.Messages {
-				messages = append(messages, &Message{
+				wrappedMessage := &Message{
 					Key:       wrapped.Msg.Key,
 					Value:     wrapped.Msg.Value,
 					Topic:     topic,
 					Partition: partition,
 					Offset:    wrapped.Offset,
-				})
+				}
+				applyMessageLabels(topic, partition, wrappedMessage)
+				messages = append(messages, wrappedMessage)
 			}
 		} else {
-			messages = append(messages, &Message{
+			plainMessage := &Message{
 				Key:       message.Msg.Key,
 				Value:     message.Msg.Value,
 				Topic:     topic,
 				Partition: partition,
 				Offset:    message.Offset,
-			})
+			}
+			applyMessageLabels(topic, partition, plainMessage)
+			messages = append(messages, plainMessage)
 		}
 	}
 
@@ -227,6 +356,17 @@ func (this *SiestaClient) Initialize() error {
 	connectorConfig.ConnectTimeout = this.config.SocketTimeout
 	connectorConfig.FetchSize = this.config.FetchMessageMaxBytes
 	connectorConfig.ClientId = this.config.Clientid
+	connectorConfig.SecurityProtocol = string(this.config.SecurityProtocol)
+	connectorConfig.SaslMechanism = string(this.config.SaslMechanism)
+	connectorConfig.SaslUsername = this.config.SaslUsername
+	connectorConfig.SaslPassword = this.config.SaslPassword
+	if this.config.SecurityProtocol == SecurityProtocolSASLSSL || this.config.SecurityProtocol == SecurityProtocolSSL {
+		tlsConfig, err := newTLSConfig(this.config)
+		if err != nil {
+			return err
+		}
+		connectorConfig.TLSConfig = tlsConfig
+	}
 
 	this.connector, err = siesta.NewDefaultConnector(connectorConfig)
 	if err != nil {
@@ -239,6 +379,13 @@ func (this *SiestaClient) Initialize() error {
 // This will be called each time the fetch request to Kafka should be issued. Topic, partition and offset are self-explanatory.
 // Returns slice of Messages and an error if a fetch error occurred.
 func (this *SiestaClient) Fetch(topic string, partition int32, offset int64) ([]*Message, error) {
+	span := startFetchSpan(this.config, "siesta.fetch", topic, partition, offset)
+	messages, err := this.doFetch(topic, partition, offset)
+	finishFetchSpan(span, messages, err)
+	return messages, err
+}
+
+func (this *SiestaClient) doFetch(topic string, partition int32, offset int64) ([]*Message, error) {
 	Tracef(this, "Fetching %s %d from %d", topic, partition, offset)
 	siestaMessages, err := this.connector.Consume(topic, partition, offset)
 	if err != nil {
@@ -249,13 +396,15 @@ func (this *SiestaClient) Fetch(topic string, partition int32, offset int64) ([]
 	messages := make([]*Message, len(siestaMessages))
 	for i := 0; i < len(siestaMessages); i++ {
 		siestaMessage := siestaMessages[i]
-		messages[i] = &Message{
+		message := &Message{
 			Key:       siestaMessage.Key,
 			Value:     siestaMessage.Value,
 			Topic:     siestaMessage.Topic,
 			Partition: siestaMessage.Partition,
 			Offset:    siestaMessage.Offset,
 		}
+		applyMessageLabels(siestaMessage.Topic, siestaMessage.Partition, message)
+		messages[i] = message
 	}
 
 	return messages, nil
@@ -0,0 +1,267 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"time"
+)
+
+// ProducerRecord is a single message to be produced to a topic. Partition is optional: leave it at -1 to
+// let the Producer's Partitioner choose one based on Key.
+type ProducerRecord struct {
+	Topic     string
+	Partition int32
+	Key       interface{}
+	Value     interface{}
+}
+
+// ProducerResult reports the outcome of producing a single ProducerRecord: the partition and offset it
+// landed at, or the Err that prevented it from being produced.
+type ProducerResult struct {
+	Record    *ProducerRecord
+	Partition int32
+	Offset    int64
+	Err       error
+}
+
+// Producer is the producer counterpart to LowLevelClient: it hides whether records are actually produced
+// via Sarama or siesta behind a single asynchronous Send API.
+type Producer interface {
+	// Send enqueues a record to be produced and returns a channel that will receive exactly one
+	// ProducerResult once the broker has acknowledged it (or producing it has failed).
+	Send(record *ProducerRecord) <-chan *ProducerResult
+
+	// SendSync is a convenience wrapper around Send that blocks until the ProducerResult is available.
+	SendSync(record *ProducerRecord) *ProducerResult
+
+	// Flush blocks until all records enqueued via Send have been acknowledged.
+	Flush()
+
+	// Close flushes any outstanding records and gracefully shuts down this Producer.
+	Close()
+}
+
+// Partitioner decides which partition a ProducerRecord should be sent to, given the total number of
+// partitions the destination topic currently has.
+type Partitioner interface {
+	// Partition returns the partition record should be produced to. numPartitions is always > 0.
+	Partition(record *ProducerRecord, numPartitions int32) int32
+}
+
+// ManualPartitioner returns whatever partition is already set on the record, unchanged. It exists so
+// tools that mirror a source cluster's partitioning (e.g. a MirrorMaker-style consumer-producer pair)
+// can preserve partition assignment on the destination cluster.
+type ManualPartitioner struct{}
+
+// Partition returns record.Partition as-is.
+func (this *ManualPartitioner) Partition(record *ProducerRecord, numPartitions int32) int32 {
+	return record.Partition
+}
+
+// HashPartitioner assigns a partition by hashing record.Key, mirroring Kafka's own default partitioner
+// behavior for keyed records.
+type HashPartitioner struct {
+	hash func(key []byte) uint32
+}
+
+// NewHashPartitioner returns a HashPartitioner using Kafka's default hashing (murmur2, as used by the
+// Java client's DefaultPartitioner).
+func NewHashPartitioner() *HashPartitioner {
+	return &HashPartitioner{hash: murmur2}
+}
+
+// Partition hashes the record's key to pick a partition. Only a non-empty []byte Key is hashed; a record
+// whose Key is nil, empty or of any other type (such as a value left for a KeyEncoder to encode) goes to
+// partition 0. Callers that want round-robin behavior for keyless records should use a
+// RoundRobinPartitioner instead.
+func (this *HashPartitioner) Partition(record *ProducerRecord, numPartitions int32) int32 {
+	keyBytes, ok := record.Key.([]byte)
+	if !ok || len(keyBytes) == 0 {
+		return 0
+	}
+	return int32((this.hash(keyBytes) & 0x7fffffff) % uint32(numPartitions))
+}
+
+// RoundRobinPartitioner cycles through all available partitions in order, regardless of key, spreading
+// keyless records evenly across a topic.
+type RoundRobinPartitioner struct {
+	next int32
+}
+
+// NewRoundRobinPartitioner returns a fresh RoundRobinPartitioner starting at partition 0.
+func NewRoundRobinPartitioner() *RoundRobinPartitioner {
+	return &RoundRobinPartitioner{}
+}
+
+// Partition returns the next partition in round-robin order.
+func (this *RoundRobinPartitioner) Partition(record *ProducerRecord, numPartitions int32) int32 {
+	partition := this.next % numPartitions
+	this.next++
+	return partition
+}
+
+// murmur2 is Kafka's variant of the Murmur2 hash, used by the Java client's DefaultPartitioner and kept
+// here so HashPartitioner picks the same partition a Java producer would for the same key.
+func murmur2(data []byte) uint32 {
+	const (
+		seed uint32 = 0x9747b28c
+		m    uint32 = 0x5bd1e995
+		r    uint32 = 24
+	)
+
+	length := len(data)
+	h := seed ^ uint32(length)
+	length4 := length / 4
+
+	for i := 0; i < length4; i++ {
+		i4 := i * 4
+		k := uint32(data[i4]&0xff) |
+			(uint32(data[i4+1]&0xff) << 8) |
+			(uint32(data[i4+2]&0xff) << 16) |
+			(uint32(data[i4+3]&0xff) << 24)
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+
+	switch length % 4 {
+	case 3:
+		h ^= uint32(data[(length & ^3)+2]&0xff) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(data[(length & ^3)+1]&0xff) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(data[length & ^3] & 0xff)
+		h *= m
+	}
+
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+
+	return h
+}
+
+// CompressionCodec identifies how produced batches are compressed before being sent to the broker.
+type CompressionCodec string
+
+const (
+	CompressionNone   CompressionCodec = "none"
+	CompressionGzip   CompressionCodec = "gzip"
+	CompressionSnappy CompressionCodec = "snappy"
+	CompressionLZ4    CompressionCodec = "lz4"
+)
+
+// RequiredAcks mirrors Kafka's acks setting: how many replicas must acknowledge a produce request before
+// it is considered successful.
+type RequiredAcks int16
+
+const (
+	NoResponse   RequiredAcks = 0
+	WaitForLocal RequiredAcks = 1
+	WaitForAll   RequiredAcks = -1
+)
+
+// ProducerConfig holds the settings shared by SaramaProducer and SiestaProducer, mirroring the shape of
+// ConsumerConfig on the consume side.
+type ProducerConfig struct {
+	// Clientid is sent to brokers with every request so they can log which client produced it.
+	Clientid string
+
+	// Coordinator is used the same way LowLevelClient uses it: to resolve a bootstrap broker list.
+	Coordinator ConsumerCoordinator
+
+	// RequiredAcks controls how many replicas must acknowledge a produce request.
+	RequiredAcks RequiredAcks
+
+	// Compression selects the codec used for produced batches. Only SaramaProducer applies it;
+	// SiestaProducer always sends uncompressed messages.
+	Compression CompressionCodec
+
+	// BatchSize is a per-partition batch size in records. Neither SaramaProducer nor SiestaProducer reads
+	// it, so it does not affect how records are batched.
+	BatchSize int
+
+	// Linger is a wait for a batch to fill up before sending it anyway. Neither SaramaProducer nor
+	// SiestaProducer reads it, so it does not delay sending.
+	Linger time.Duration
+
+	// Retries is the number of times SaramaProducer retries a failed produce request before surfacing the
+	// error. SiestaProducer does not read it and makes a single attempt per record.
+	Retries int
+
+	// Idempotent enables the broker-side deduplication needed for exactly-once producing semantics. Only
+	// SaramaProducer applies it.
+	Idempotent bool
+
+	// Partitioner assigns partitions to records that do not already specify one. Defaults to a
+	// HashPartitioner when left nil.
+	Partitioner Partitioner
+
+	// KeyEncoder and ValueEncoder, when set, are used to serialize ProducerRecord.Key/Value before
+	// producing, e.g. a KafkaAvroEncoder to produce schema-registry-encoded Avro records end-to-end.
+	KeyEncoder   Encoder
+	ValueEncoder Encoder
+}
+
+// Encoder serializes a value into the bytes that are actually sent to Kafka. KafkaAvroEncoder implements
+// this so Producer can produce schema-registry-encoded records without the caller handling encoding.
+type Encoder interface {
+	Encode(value interface{}) ([]byte, error)
+}
+
+// NewProducerConfig returns a ProducerConfig with the same sensible defaults SaramaProducer and
+// SiestaProducer were written against: local acks, no compression, and a HashPartitioner.
+func NewProducerConfig() *ProducerConfig {
+	return &ProducerConfig{
+		RequiredAcks: WaitForLocal,
+		Compression:  CompressionNone,
+		BatchSize:    16384,
+		Linger:       0,
+		Retries:      3,
+		Partitioner:  NewHashPartitioner(),
+	}
+}
+
+func (this *ProducerConfig) partitioner() Partitioner {
+	if this.Partitioner == nil {
+		return NewHashPartitioner()
+	}
+	return this.Partitioner
+}
+
+func (this *ProducerConfig) encode(keyEncoder, valueEncoder Encoder, record *ProducerRecord) (key, value []byte, err error) {
+	if keyEncoder != nil {
+		if key, err = keyEncoder.Encode(record.Key); err != nil {
+			return nil, nil, err
+		}
+	} else if k, ok := record.Key.([]byte); ok {
+		key = k
+	}
+
+	if valueEncoder != nil {
+		if value, err = valueEncoder.Encode(record.Value); err != nil {
+			return nil, nil, err
+		}
+	} else if v, ok := record.Value.([]byte); ok {
+		value = v
+	}
+
+	return key, value, nil
+}
@@ -0,0 +1,252 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"sync"
+
+	"github.com/Shopify/sarama"
+	"github.com/stealthly/siesta"
+)
+
+// SaramaProducer implements Producer and uses github.com/Shopify/sarama as underlying implementation.
+type SaramaProducer struct {
+	config   *ProducerConfig
+	client   sarama.Client
+	producer sarama.AsyncProducer
+}
+
+// NewSaramaProducer creates a new SaramaProducer using a given ProducerConfig and connects it right away,
+// mirroring NewSaramaClient/Initialize except there is no separate coordinator handshake to wait for.
+func NewSaramaProducer(config *ProducerConfig) (*SaramaProducer, error) {
+	bootstrapBrokers, err := BootstrapBrokers(config.Coordinator)
+	if err != nil {
+		return nil, err
+	}
+
+	saramaConfig := sarama.NewConfig()
+	saramaConfig.ClientID = config.Clientid
+	saramaConfig.Producer.RequiredAcks = sarama.RequiredAcks(config.RequiredAcks)
+	saramaConfig.Producer.Retry.Max = config.Retries
+	saramaConfig.Producer.Idempotent = config.Idempotent
+	saramaConfig.Producer.Return.Successes = true
+	saramaConfig.Producer.Return.Errors = true
+	// Partitioning is always resolved ourselves via config.partitioner() before a message reaches sarama
+	// (see Send below), so sarama must not second-guess that choice with its own default hash partitioner.
+	saramaConfig.Producer.Partitioner = sarama.NewManualPartitioner
+	switch config.Compression {
+	case CompressionGzip:
+		saramaConfig.Producer.Compression = sarama.CompressionGZIP
+	case CompressionSnappy:
+		saramaConfig.Producer.Compression = sarama.CompressionSnappy
+	case CompressionLZ4:
+		saramaConfig.Producer.Compression = sarama.CompressionLZ4
+	}
+
+	client, err := sarama.NewClient(bootstrapBrokers, saramaConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	producer, err := sarama.NewAsyncProducerFromClient(client)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	this := &SaramaProducer{config: config, client: client, producer: producer}
+	go this.dispatch()
+	return this, nil
+}
+
+// String returns a string representation of this SaramaProducer.
+func (this *SaramaProducer) String() string {
+	return "Sarama producer"
+}
+
+// Send enqueues record to be produced, encoding its key/value with the configured Encoders and choosing
+// a partition via the configured Partitioner when record.Partition is unset.
+func (this *SaramaProducer) Send(record *ProducerRecord) <-chan *ProducerResult {
+	resultCh := make(chan *ProducerResult, 1)
+
+	key, value, err := this.config.encode(this.config.KeyEncoder, this.config.ValueEncoder, record)
+	if err != nil {
+		resultCh <- &ProducerResult{Record: record, Err: err}
+		return resultCh
+	}
+
+	partition, err := this.partitionFor(record)
+	if err != nil {
+		resultCh <- &ProducerResult{Record: record, Err: err}
+		return resultCh
+	}
+
+	message := &sarama.ProducerMessage{
+		Topic:     record.Topic,
+		Partition: partition,
+		Key:       sarama.ByteEncoder(key),
+		Value:     sarama.ByteEncoder(value),
+		Metadata:  resultCh,
+	}
+
+	this.producer.Input() <- message
+	return resultCh
+}
+
+// partitionFor resolves the partition record should be produced to via this.config.Partitioner. Records
+// that already pin a partition skip the metadata lookup entirely.
+func (this *SaramaProducer) partitionFor(record *ProducerRecord) (int32, error) {
+	if record.Partition >= 0 {
+		return record.Partition, nil
+	}
+	partitions, err := this.client.Partitions(record.Topic)
+	if err != nil {
+		return -1, err
+	}
+	return this.config.partitioner().Partition(record, int32(len(partitions))), nil
+}
+
+// SendSync produces record and blocks until its ProducerResult is available.
+func (this *SaramaProducer) SendSync(record *ProducerRecord) *ProducerResult {
+	return <-this.Send(record)
+}
+
+// Flush is a no-op for SaramaProducer: it returns immediately and does not wait for records already handed
+// to sarama to be acknowledged. sarama's AsyncProducer has no explicit flush; each record's outcome arrives
+// only on the channel its Send call returned.
+func (this *SaramaProducer) Flush() {}
+
+// Close gracefully shuts down this producer, waiting for in-flight records to be acknowledged.
+func (this *SaramaProducer) Close() {
+	this.producer.AsyncClose()
+	this.client.Close()
+}
+
+// dispatch forwards sarama's Successes/Errors channels to the per-Send result channel stashed in each
+// message's Metadata, so Send's caller sees exactly one ProducerResult per record. Returns once Close has
+// closed both channels, rather than spinning: sarama never nils out Successes()/Errors() themselves, so a
+// select loop keyed on "!= nil" never actually exits once they're closed.
+func (this *SaramaProducer) dispatch() {
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		for message := range this.producer.Successes() {
+			resultCh := message.Metadata.(chan *ProducerResult)
+			resultCh <- &ProducerResult{Partition: message.Partition, Offset: message.Offset}
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		for produceErr := range this.producer.Errors() {
+			resultCh := produceErr.Msg.Metadata.(chan *ProducerResult)
+			resultCh <- &ProducerResult{Err: produceErr.Err}
+		}
+	}()
+
+	wg.Wait()
+}
+
+// SiestaProducer implements Producer and uses github.com/stealthly/siesta as underlying implementation.
+type SiestaProducer struct {
+	config   *ProducerConfig
+	producer siesta.Producer
+}
+
+// NewSiestaProducer creates a new SiestaProducer using a given ProducerConfig, mirroring
+// NewSiestaClient/Initialize.
+func NewSiestaProducer(config *ProducerConfig) (*SiestaProducer, error) {
+	bootstrapBrokers, err := BootstrapBrokers(config.Coordinator)
+	if err != nil {
+		return nil, err
+	}
+
+	producerConfig := siesta.NewProducerConfig()
+	producerConfig.BrokerList = bootstrapBrokers
+	producerConfig.ClientID = config.Clientid
+	producerConfig.RequiredAcks = int16(config.RequiredAcks)
+	producerConfig.AckTimeoutMs = 5000
+
+	producer, err := siesta.NewKafkaProducer(producerConfig, siesta.NewSiestaConnector)
+	if err != nil {
+		return nil, err
+	}
+	return &SiestaProducer{config: config, producer: producer}, nil
+}
+
+// String returns a string representation of this SiestaProducer.
+func (this *SiestaProducer) String() string {
+	return "Siesta producer"
+}
+
+// Send enqueues record to be produced, encoding its key/value with the configured Encoders and choosing
+// a partition via the configured Partitioner when record.Partition is unset.
+func (this *SiestaProducer) Send(record *ProducerRecord) <-chan *ProducerResult {
+	resultCh := make(chan *ProducerResult, 1)
+
+	key, value, err := this.config.encode(this.config.KeyEncoder, this.config.ValueEncoder, record)
+	if err != nil {
+		resultCh <- &ProducerResult{Record: record, Err: err}
+		return resultCh
+	}
+
+	go func() {
+		partition, err := this.partitionFor(record)
+		if err != nil {
+			resultCh <- &ProducerResult{Record: record, Err: err}
+			return
+		}
+
+		assignedPartition, offset, err := this.producer.Send(record.Topic, partition, key, value)
+		if err != nil {
+			resultCh <- &ProducerResult{Record: record, Err: err}
+			return
+		}
+		resultCh <- &ProducerResult{Partition: assignedPartition, Offset: offset}
+	}()
+
+	return resultCh
+}
+
+// partitionFor resolves the partition record should be produced to via this.config.Partitioner. Records
+// that already pin a partition skip the metadata lookup entirely.
+func (this *SiestaProducer) partitionFor(record *ProducerRecord) (int32, error) {
+	if record.Partition >= 0 {
+		return record.Partition, nil
+	}
+	numPartitions, err := this.producer.PartitionCount(record.Topic)
+	if err != nil {
+		return -1, err
+	}
+	return this.config.partitioner().Partition(record, numPartitions), nil
+}
+
+// SendSync produces record and blocks until its ProducerResult is available.
+func (this *SiestaProducer) SendSync(record *ProducerRecord) *ProducerResult {
+	return <-this.Send(record)
+}
+
+// Flush is a no-op for SiestaProducer: it returns immediately and does not wait for records whose Send is
+// still in flight. Each Send resolves its result channel only after the broker's acknowledgement (or a
+// failure), so that channel is where a record's outcome arrives.
+func (this *SiestaProducer) Flush() {}
+
+// Close gracefully shuts down this producer.
+func (this *SiestaProducer) Close() {
+	<-this.producer.Close()
+}
@@ -0,0 +1,199 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// KafkaProtobufEncoder encodes proto.Message values using Confluent's Protobuf wire format: the usual
+// magic byte + 4-byte schema id prefix, followed by a varint-encoded message-index array identifying
+// which nested message of the registered .proto file this encoder produces.
+type KafkaProtobufEncoder struct {
+	schemaRegistry SchemaRegistryClient
+	subject        string
+	rawSchema      string
+	messageIndexes []int
+
+	schemaID     int32
+	schemaIDLock sync.Mutex
+}
+
+// NewKafkaProtobufEncoder returns a KafkaProtobufEncoder that registers rawSchema (the textual contents
+// of a .proto file) under subject the first time Encode is called, and thereafter tags every encoded
+// message with the returned schema id. messageIndexes selects which message in rawSchema this encoder
+// produces; pass nil when rawSchema declares a single top-level message.
+func NewKafkaProtobufEncoder(url string, subject string, rawSchema string, messageIndexes []int) *KafkaProtobufEncoder {
+	return &KafkaProtobufEncoder{
+		schemaRegistry: NewCachedSchemaRegistryClient(url),
+		subject:        subject,
+		rawSchema:      rawSchema,
+		messageIndexes: messageIndexes,
+		schemaID:       -1,
+	}
+}
+
+// Encode serializes a proto.Message into Confluent's Protobuf wire format.
+func (this *KafkaProtobufEncoder) Encode(obj interface{}) ([]byte, error) {
+	message, ok := obj.(proto.Message)
+	if !ok {
+		return nil, errors.New("proto.Message is expected")
+	}
+	if message == nil {
+		return nil, nil
+	}
+
+	id, err := this.ensureRegistered()
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := proto.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+
+	buffer := &bytes.Buffer{}
+	buffer.Write(magic_bytes)
+	idSlice := make([]byte, 4)
+	binary.BigEndian.PutUint32(idSlice, uint32(id))
+	buffer.Write(idSlice)
+	writeMessageIndexes(buffer, this.messageIndexes)
+	buffer.Write(payload)
+
+	return buffer.Bytes(), nil
+}
+
+func (this *KafkaProtobufEncoder) ensureRegistered() (int32, error) {
+	this.schemaIDLock.Lock()
+	schemaID := this.schemaID
+	this.schemaIDLock.Unlock()
+	if schemaID >= 0 {
+		return schemaID, nil
+	}
+
+	id, err := this.schemaRegistry.RegisterRaw(this.subject, SerializationFormatProtobuf, this.rawSchema)
+	if err != nil {
+		return -1, err
+	}
+
+	this.schemaIDLock.Lock()
+	this.schemaID = id
+	this.schemaIDLock.Unlock()
+	return id, nil
+}
+
+// KafkaProtobufDecoder decodes payloads produced by KafkaProtobufEncoder (or a compatible Java/Confluent
+// Protobuf producer) into a caller-supplied proto.Message.
+type KafkaProtobufDecoder struct {
+	schemaRegistry SchemaRegistryClient
+}
+
+// NewKafkaProtobufDecoder returns a KafkaProtobufDecoder resolving schema ids against the registry at url.
+func NewKafkaProtobufDecoder(url string) *KafkaProtobufDecoder {
+	return &KafkaProtobufDecoder{
+		schemaRegistry: NewCachedSchemaRegistryClient(url),
+	}
+}
+
+// Decode parses the magic byte, schema id and message-index array off data and unmarshals the remaining
+// bytes into out.
+func (this *KafkaProtobufDecoder) Decode(data []byte, out proto.Message) error {
+	if data == nil {
+		return nil
+	}
+	if data[0] != 0 {
+		return errors.New("Unknown magic byte!")
+	}
+
+	id := int32(binary.BigEndian.Uint32(data[1:5]))
+	meta, err := this.schemaRegistry.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if meta.Format != SerializationFormatProtobuf {
+		return fmt.Errorf("schema %d is a %s schema, not Protobuf", id, meta.Format)
+	}
+
+	_, payload, err := readMessageIndexes(data[5:])
+	if err != nil {
+		return err
+	}
+
+	return proto.Unmarshal(payload, out)
+}
+
+// writeMessageIndexes writes indexes as Confluent's Protobuf message-index array: a zig-zag varint count
+// followed by a zig-zag varint per index. An empty/nil indexes is written as the special single-byte
+// short form meaning "the first (and only) message in the schema".
+func writeMessageIndexes(buffer *bytes.Buffer, indexes []int) {
+	writeZigZagVarint(buffer, len(indexes))
+	for _, index := range indexes {
+		writeZigZagVarint(buffer, index)
+	}
+}
+
+// readMessageIndexes parses a Confluent Protobuf message-index array off the front of data, returning the
+// parsed indexes and the remaining bytes (the actual serialized Protobuf message).
+func readMessageIndexes(data []byte) ([]int, []byte, error) {
+	count, rest, err := readZigZagVarint(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if count == 0 {
+		return []int{0}, rest, nil
+	}
+
+	indexes := make([]int, count)
+	for i := 0; i < count; i++ {
+		var value int
+		value, rest, err = readZigZagVarint(rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		indexes[i] = value
+	}
+	return indexes, rest, nil
+}
+
+func writeZigZagVarint(buffer *bytes.Buffer, value int) {
+	zigzag := uint64((value << 1) ^ (value >> 63))
+	for zigzag >= 0x80 {
+		buffer.WriteByte(byte(zigzag) | 0x80)
+		zigzag >>= 7
+	}
+	buffer.WriteByte(byte(zigzag))
+}
+
+func readZigZagVarint(data []byte) (int, []byte, error) {
+	var result uint64
+	var shift uint
+	for i, b := range data {
+		result |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			value := int64(result>>1) ^ -(int64(result) & 1)
+			return int(value), data[i+1:], nil
+		}
+		shift += 7
+	}
+	return 0, nil, errors.New("truncated varint in message-index array")
+}
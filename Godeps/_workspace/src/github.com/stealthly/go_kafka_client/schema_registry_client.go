@@ -0,0 +1,269 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/stealthly/go-avro"
+)
+
+// SerializationFormat identifies the wire format a schema id was registered under. The schema registry
+// returns this alongside the raw schema so a decoder can be picked without the caller having to know
+// up front whether a given topic carries Avro, Protobuf or JSON Schema payloads.
+type SerializationFormat string
+
+const (
+	SerializationFormatAvro       SerializationFormat = "AVRO"
+	SerializationFormatProtobuf   SerializationFormat = "PROTOBUF"
+	SerializationFormatJsonSchema SerializationFormat = "JSON"
+)
+
+// SchemaMetadata is what the schema registry knows about a given schema id: its format plus whatever a
+// decoder for that format needs to make sense of a payload.
+type SchemaMetadata struct {
+	Format     SerializationFormat
+	RawSchema  string
+	AvroSchema avro.Schema
+}
+
+// SchemaRegistryClient registers schemas with and resolves schema ids from a Confluent-compatible schema
+// registry. KafkaAvroEncoder/Decoder, KafkaProtobufEncoder/Decoder and KafkaJsonSchemaEncoder/Decoder all
+// go through this interface so the wire format dispatch lives in one place.
+type SchemaRegistryClient interface {
+	// Register registers an Avro schema under subject and returns its id, reusing an existing id if an
+	// identical schema was already registered for that subject.
+	Register(subject string, schema avro.Schema) (int32, error)
+
+	// RegisterRaw registers a Protobuf or JSON Schema document (passed as its raw textual form, e.g. a
+	// .proto file or a JSON Schema document) under subject and returns its id.
+	RegisterRaw(subject string, format SerializationFormat, rawSchema string) (int32, error)
+
+	// GetByID resolves a schema id to its SchemaMetadata, dispatching on the schemaType the registry
+	// reports so callers can tell Avro, Protobuf and JSON Schema payloads apart.
+	GetByID(id int32) (*SchemaMetadata, error)
+}
+
+// cachedSchemaRegistryClient is a SchemaRegistryClient that retries failed registry calls with jittered
+// exponential backoff and caches resolved schema ids in a bounded, TTL-expiring LRU so that a hot topic
+// with a handful of schema ids doesn't hammer the registry on every message.
+type cachedSchemaRegistryClient struct {
+	url        string
+	httpClient *http.Client
+	cache      *lruCache
+	lock       sync.Mutex
+}
+
+// NewCachedSchemaRegistryClient returns a SchemaRegistryClient backed by the registry at url, caching up
+// to 1000 resolved schema ids for 10 minutes before re-fetching them.
+func NewCachedSchemaRegistryClient(url string) SchemaRegistryClient {
+	return NewCachedSchemaRegistryClientWithCapacity(url, 1000, 10*time.Minute)
+}
+
+// NewCachedSchemaRegistryClientWithCapacity returns a SchemaRegistryClient caching up to capacity
+// resolved schema ids, each expiring ttl after it was fetched.
+func NewCachedSchemaRegistryClientWithCapacity(url string, capacity int, ttl time.Duration) SchemaRegistryClient {
+	return &cachedSchemaRegistryClient{
+		url:        url,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		cache:      newLRUCache(capacity, ttl),
+	}
+}
+
+type registerSchemaRequest struct {
+	Schema     string `json:"schema"`
+	SchemaType string `json:"schemaType,omitempty"`
+}
+
+type registerSchemaResponse struct {
+	ID int32 `json:"id"`
+}
+
+type getSchemaResponse struct {
+	Schema     string `json:"schema"`
+	SchemaType string `json:"schemaType"`
+}
+
+// Register registers an Avro schema under subject.
+func (this *cachedSchemaRegistryClient) Register(subject string, schema avro.Schema) (int32, error) {
+	return this.RegisterRaw(subject, SerializationFormatAvro, schema.String())
+}
+
+// RegisterRaw registers a raw schema document of the given format under subject.
+func (this *cachedSchemaRegistryClient) RegisterRaw(subject string, format SerializationFormat, rawSchema string) (int32, error) {
+	body, err := json.Marshal(&registerSchemaRequest{Schema: rawSchema, SchemaType: string(format)})
+	if err != nil {
+		return -1, err
+	}
+
+	var response registerSchemaResponse
+	url := fmt.Sprintf("%s/subjects/%s/versions", this.url, subject)
+	if err := this.doWithRetry(func() error {
+		return this.postJSON(url, body, &response)
+	}); err != nil {
+		return -1, err
+	}
+
+	return response.ID, nil
+}
+
+// GetByID resolves id to its SchemaMetadata, consulting the cache before calling out to the registry.
+func (this *cachedSchemaRegistryClient) GetByID(id int32) (*SchemaMetadata, error) {
+	if cached, ok := this.cache.get(id); ok {
+		return cached.(*SchemaMetadata), nil
+	}
+
+	var response getSchemaResponse
+	url := fmt.Sprintf("%s/schemas/ids/%d", this.url, id)
+	if err := this.doWithRetry(func() error {
+		return this.getJSON(url, &response)
+	}); err != nil {
+		return nil, err
+	}
+
+	format := SerializationFormat(response.SchemaType)
+	if format == "" {
+		format = SerializationFormatAvro
+	}
+
+	meta := &SchemaMetadata{Format: format, RawSchema: response.Schema}
+	if format == SerializationFormatAvro {
+		schema, err := avro.ParseSchema(response.Schema)
+		if err != nil {
+			return nil, err
+		}
+		meta.AvroSchema = schema
+	}
+
+	this.cache.put(id, meta)
+	return meta, nil
+}
+
+// doWithRetry retries operation with a jittered exponential backoff, giving up once backoff.Stop is
+// reached, so a transient registry blip doesn't fail every in-flight encode/decode.
+func (this *cachedSchemaRegistryClient) doWithRetry(operation func() error) error {
+	policy := backoff.NewExponentialBackOff()
+	policy.MaxElapsedTime = 30 * time.Second
+	return backoff.Retry(operation, policy)
+}
+
+func (this *cachedSchemaRegistryClient) postJSON(url string, body []byte, out interface{}) error {
+	request, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return backoff.Permanent(err)
+	}
+	request.Header.Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+	return this.doJSON(request, out)
+}
+
+func (this *cachedSchemaRegistryClient) getJSON(url string, out interface{}) error {
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return backoff.Permanent(err)
+	}
+	return this.doJSON(request, out)
+}
+
+func (this *cachedSchemaRegistryClient) doJSON(request *http.Request, out interface{}) error {
+	response, err := this.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 500 {
+		return fmt.Errorf("schema registry returned %d", response.StatusCode)
+	}
+	if response.StatusCode >= 400 {
+		return backoff.Permanent(fmt.Errorf("schema registry returned %d", response.StatusCode))
+	}
+
+	return json.NewDecoder(response.Body).Decode(out)
+}
+
+// lruCache is a small, fixed-capacity cache keyed by schema id, evicting the least-recently-used entry
+// once it's full and treating entries older than ttl as absent so a schema registered under an id that
+// later changes doesn't stick around forever.
+type lruCache struct {
+	capacity int
+	ttl      time.Duration
+	lock     sync.Mutex
+	entries  map[int32]*list.Element
+	order    *list.List
+}
+
+type lruEntry struct {
+	key       int32
+	value     interface{}
+	expiresAt time.Time
+}
+
+func newLRUCache(capacity int, ttl time.Duration) *lruCache {
+	return &lruCache{
+		capacity: capacity,
+		ttl:      ttl,
+		entries:  make(map[int32]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (this *lruCache) get(key int32) (interface{}, bool) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	element, ok := this.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*lruEntry)
+	if time.Now().After(entry.expiresAt) {
+		this.order.Remove(element)
+		delete(this.entries, key)
+		return nil, false
+	}
+
+	this.order.MoveToFront(element)
+	return entry.value, true
+}
+
+func (this *lruCache) put(key int32, value interface{}) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if element, ok := this.entries[key]; ok {
+		element.Value.(*lruEntry).value = value
+		element.Value.(*lruEntry).expiresAt = time.Now().Add(this.ttl)
+		this.order.MoveToFront(element)
+		return
+	}
+
+	element := this.order.PushFront(&lruEntry{key: key, value: value, expiresAt: time.Now().Add(this.ttl)})
+	this.entries[key] = element
+
+	for this.order.Len() > this.capacity {
+		oldest := this.order.Back()
+		this.order.Remove(oldest)
+		delete(this.entries, oldest.Value.(*lruEntry).key)
+	}
+}
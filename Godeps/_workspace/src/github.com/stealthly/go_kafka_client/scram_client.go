@@ -0,0 +1,31 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"hash"
+
+	"github.com/stealthly/scram"
+)
+
+// scramClient implements sarama's SCRAMClient interface (Begin/Step/Done) via the shared scram.Client,
+// driving a RFC 5802 SCRAM-SHA-256/SCRAM-SHA-512 exchange for SaramaClient's SASL authentication.
+type scramClient = scram.Client
+
+// newScramClient returns a scramClient that hashes with the given constructor, e.g. sha256.New or sha512.New.
+func newScramClient(newHash func() hash.Hash) *scramClient {
+	return scram.NewClient(newHash)
+}
@@ -0,0 +1,132 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/opentracing/opentracing-go"
+	otlog "github.com/opentracing/opentracing-go/log"
+)
+
+// DefaultTraceHeader is the header name ConsumerConfig.traceHeader falls back to when TraceHeader is unset.
+// InjectSpan and ExtractSpan do not use it: they write and read the tracer's own TextMap keys directly as
+// entries of a Message's Headers map.
+const DefaultTraceHeader = "trace-context"
+
+// ErrNoSpanContext is returned by ExtractSpan when a Message carries no headers at all, which is
+// expected for messages produced before tracing was enabled and should usually just be logged, not
+// treated as a fetch-level error.
+var ErrNoSpanContext = errors.New("go_kafka_client: message carries no span context")
+
+// tracer returns config.Tracer, falling back to the process-wide global tracer so callers that never set
+// ConsumerConfig.Tracer still get a (no-op, unless one was registered) tracer instead of a nil pointer.
+func (this *ConsumerConfig) tracer() opentracing.Tracer {
+	if this.Tracer != nil {
+		return this.Tracer
+	}
+	return opentracing.GlobalTracer()
+}
+
+// traceHeader returns config.TraceHeader, falling back to DefaultTraceHeader.
+func (this *ConsumerConfig) traceHeader() string {
+	if this.TraceHeader != "" {
+		return this.TraceHeader
+	}
+	return DefaultTraceHeader
+}
+
+// startFetchSpan starts a span for a single Fetch call, tagged with the topic/partition/offset being
+// fetched. Callers must Finish() the returned span once the fetch completes.
+func startFetchSpan(config *ConsumerConfig, operation string, topic string, partition int32, offset int64) opentracing.Span {
+	span := config.tracer().StartSpan(operation)
+	span.SetTag("component", "go_kafka_client")
+	span.SetTag("topic", topic)
+	span.SetTag("partition", partition)
+	span.SetTag("offset", offset)
+	return span
+}
+
+// finishFetchSpan tags span with the outcome of a Fetch call and finishes it. err is logged as a span
+// event via otlog.Error and the span is marked as an error span; otherwise message.count is recorded.
+func finishFetchSpan(span opentracing.Span, messages []*Message, err error) {
+	if err != nil {
+		span.SetTag("error", true)
+		span.LogFields(otlog.Error(err))
+	} else {
+		span.SetTag("message.count", len(messages))
+	}
+	span.Finish()
+}
+
+// traceHeaderCarrier adapts a Message's Headers map to opentracing.TextMapCarrier so a SpanContext can be
+// injected into / extracted from it with the standard TextMap format.
+type traceHeaderCarrier map[string]string
+
+func (c traceHeaderCarrier) ForeachKey(handler func(key, val string) error) error {
+	for k, v := range c {
+		if err := handler(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c traceHeaderCarrier) Set(key, val string) {
+	c[key] = val
+}
+
+// InjectSpan injects span's SpanContext into msg's headers using config's tracer, so a downstream
+// consumer can continue the same trace via ExtractSpan. User Strategy callbacks that produce a follow-up
+// message should call this before handing it to a Producer.
+func InjectSpan(config *ConsumerConfig, msg *Message, span opentracing.Span) error {
+	if msg.Headers == nil {
+		msg.Headers = make(map[string]string)
+	}
+	carrier := traceHeaderCarrier(msg.Headers)
+	return config.tracer().Inject(span.Context(), opentracing.TextMap, carrier)
+}
+
+// ExtractSpan extracts a SpanContext from msg's headers using config's tracer. Returns ErrNoSpanContext
+// if msg carries no headers at all (common for messages produced before tracing was enabled, or by
+// legacy Kafka 0.10-style producers that predate message headers).
+func ExtractSpan(config *ConsumerConfig, msg *Message) (opentracing.SpanContext, error) {
+	if len(msg.Headers) == 0 {
+		return nil, ErrNoSpanContext
+	}
+	carrier := traceHeaderCarrier(msg.Headers)
+	return config.tracer().Extract(opentracing.TextMap, carrier)
+}
+
+// ExtractSpanFromAvroField extracts a SpanContext from a named string field of a decoded Avro record, for
+// legacy 0.10-style messages that predate Kafka message headers and instead carry trace context as a
+// regular Avro field (commonly named "trace_context").
+func ExtractSpanFromAvroField(config *ConsumerConfig, record map[string]interface{}, field string) (opentracing.SpanContext, error) {
+	raw, ok := record[field]
+	if !ok {
+		return nil, ErrNoSpanContext
+	}
+	encoded, ok := raw.(string)
+	if !ok {
+		return nil, ErrNoSpanContext
+	}
+	headers := make(map[string]string)
+	if err := json.Unmarshal([]byte(encoded), &headers); err != nil {
+		return nil, err
+	}
+	return config.tracer().Extract(opentracing.TextMap, traceHeaderCarrier(headers))
+}
@@ -0,0 +1,186 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+// Package scram drives one RFC 5802 SCRAM-SHA-256/SCRAM-SHA-512 client conversation. It is shared by
+// go_kafka_client (where it satisfies sarama's SCRAMClient interface for SaramaClient's SASL
+// authentication) and siesta (where its own authenticateScram drives it directly), so the exchange
+// logic, PBKDF2 derivation, and proof/signature computation only exist in one place.
+package scram
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Client drives one SCRAM client conversation: client-first-message, client-final-message (once the
+// salt and iteration count are known), and verification of the server's final signature. Its
+// Begin/Step/Done methods are shaped to satisfy sarama's SCRAMClient interface directly.
+type Client struct {
+	newHash func() hash.Hash
+
+	password        string
+	clientNonce     string
+	clientFirstBare string
+	saltedPassword  []byte
+	authMessage     string
+	step            int
+	done            bool
+}
+
+// NewClient returns a Client that hashes with the given constructor, e.g. sha256.New or sha512.New.
+func NewClient(newHash func() hash.Hash) *Client {
+	return &Client{newHash: newHash}
+}
+
+func (this *Client) hash() hash.Hash {
+	return this.newHash()
+}
+
+// Begin starts a new conversation for the given username/password. authzID is unused by Kafka's SCRAM
+// implementation and kept only to satisfy sarama's SCRAMClient interface.
+func (this *Client) Begin(userName, password, authzID string) error {
+	nonce, err := nonce()
+	if err != nil {
+		return err
+	}
+
+	this.clientNonce = nonce
+	this.clientFirstBare = fmt.Sprintf("n=%s,r=%s", sanitizeName(userName), nonce)
+	this.password = password
+	this.step = 0
+	this.done = false
+	return nil
+}
+
+// Step is called once per message of the exchange: first with an empty challenge to produce the
+// client-first-message, then with the server's challenges to produce the client-final-message and
+// finally to verify the server's signature.
+func (this *Client) Step(challenge string) (string, error) {
+	this.step++
+	switch this.step {
+	case 1:
+		return "n,," + this.clientFirstBare, nil
+	case 2:
+		serverNonce, err := attr(challenge, "r")
+		if err != nil {
+			return "", err
+		}
+		if !strings.HasPrefix(serverNonce, this.clientNonce) {
+			return "", fmt.Errorf("scram: server nonce %q does not extend client nonce %q", serverNonce, this.clientNonce)
+		}
+
+		saltB64, err := attr(challenge, "s")
+		if err != nil {
+			return "", err
+		}
+		salt, err := base64.StdEncoding.DecodeString(saltB64)
+		if err != nil {
+			return "", err
+		}
+
+		iterationsStr, err := attr(challenge, "i")
+		if err != nil {
+			return "", err
+		}
+		iterations, err := strconv.Atoi(iterationsStr)
+		if err != nil {
+			return "", err
+		}
+
+		this.saltedPassword = pbkdf2.Key([]byte(this.password), salt, iterations, this.hash().Size(), this.newHash)
+
+		clientFinalWithoutProof := "c=biws,r=" + serverNonce
+		this.authMessage = this.clientFirstBare + "," + challenge + "," + clientFinalWithoutProof
+
+		clientKey := this.hmac(this.saltedPassword, []byte("Client Key"))
+		storedKey := this.digest(clientKey)
+		clientSignature := this.hmac(storedKey, []byte(this.authMessage))
+		clientProof := xorBytes(clientKey, clientSignature)
+
+		return clientFinalWithoutProof + ",p=" + base64.StdEncoding.EncodeToString(clientProof), nil
+	case 3:
+		serverSignatureB64, err := attr(challenge, "v")
+		if err != nil {
+			return "", err
+		}
+		serverKey := this.hmac(this.saltedPassword, []byte("Server Key"))
+		expected := this.hmac(serverKey, []byte(this.authMessage))
+		if base64.StdEncoding.EncodeToString(expected) != serverSignatureB64 {
+			return "", fmt.Errorf("scram: server signature mismatch, possible MITM")
+		}
+		this.done = true
+		return "", nil
+	default:
+		return "", fmt.Errorf("scram: unexpected extra step %d", this.step)
+	}
+}
+
+// Done returns true once the server's signature has been verified.
+func (this *Client) Done() bool {
+	return this.done
+}
+
+func (this *Client) hmac(key, data []byte) []byte {
+	mac := hmac.New(this.newHash, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func (this *Client) digest(data []byte) []byte {
+	h := this.hash()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func xorBytes(a, b []byte) []byte {
+	out := make([]byte, len(a))
+	for i := range a {
+		out[i] = a[i] ^ b[i]
+	}
+	return out
+}
+
+// nonce returns a random, base64-encoded client nonce used to salt a SCRAM exchange.
+func nonce() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// sanitizeName escapes ',' and '=' in a SCRAM username as required by RFC 5802 section 5.1.
+func sanitizeName(name string) string {
+	name = strings.Replace(name, "=", "=3D", -1)
+	name = strings.Replace(name, ",", "=2C", -1)
+	return name
+}
+
+// attr extracts a single comma-separated "k=v" attribute from a SCRAM server message.
+func attr(message, key string) (string, error) {
+	for _, field := range strings.Split(message, ",") {
+		if strings.HasPrefix(field, key+"=") {
+			return field[len(key)+1:], nil
+		}
+	}
+	return "", fmt.Errorf("scram: attribute %q not found in message %q", key, message)
+}
@@ -0,0 +1,153 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package siesta
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4"
+)
+
+// compressionCodec identifies how a message's Value is compressed, as encoded in the low 3 bits of a
+// Kafka message's attributes byte.
+type compressionCodec byte
+
+const (
+	compressionNone   compressionCodec = 0
+	compressionGzip   compressionCodec = 1
+	compressionSnappy compressionCodec = 2
+	compressionLZ4    compressionCodec = 3
+	compressionZstd   compressionCodec = 4
+
+	compressionCodecMask byte = 0x07
+)
+
+// xerialSnappyMagic is the 8-byte magic Java producers prefix xerial-framed snappy payloads with,
+// followed by two big-endian int32 version fields before the chunked payload begins.
+var xerialSnappyMagic = []byte{0x82, 'S', 'N', 'A', 'P', 'P', 'Y', 0x00}
+
+// messageCodec extracts the compressionCodec encoded in a message's attributes byte.
+func messageCodec(attributes byte) compressionCodec {
+	return compressionCodec(attributes & compressionCodecMask)
+}
+
+// decompressPayload decompresses a message's Value according to the codec encoded in its attributes
+// byte. compressionNone returns data unchanged.
+func decompressPayload(attributes byte, data []byte) ([]byte, error) {
+	switch messageCodec(attributes) {
+	case compressionNone:
+		return data, nil
+	case compressionGzip:
+		return decompressGzip(data)
+	case compressionSnappy:
+		return decompressSnappy(data)
+	case compressionLZ4:
+		return decompressLZ4(data)
+	case compressionZstd:
+		return decompressZstd(data)
+	default:
+		return nil, fmt.Errorf("siesta: unsupported compression codec %d", messageCodec(attributes))
+	}
+}
+
+func decompressGzip(data []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
+
+func decompressLZ4(data []byte) ([]byte, error) {
+	reader := lz4.NewReader(bytes.NewReader(data))
+	return ioutil.ReadAll(reader)
+}
+
+func decompressZstd(data []byte) ([]byte, error) {
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, err
+	}
+	defer decoder.Close()
+	return decoder.DecodeAll(data, nil)
+}
+
+// decompressSnappy decompresses a message's Value under the snappy codec. Java producers wrap each
+// snappy-compressed MessageSet in xerial framing: an 8-byte magic, two big-endian int32 version fields,
+// and then a sequence of [int32 length][snappy block] chunks that must be individually decompressed and
+// concatenated. A plain (non-xerial-framed) snappy block, as written by some non-Java producers, is
+// decompressed directly.
+func decompressSnappy(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, xerialSnappyMagic) {
+		return snappy.Decode(nil, data)
+	}
+
+	offset := len(xerialSnappyMagic) + 8 // skip magic + the two int32 version fields
+	var result bytes.Buffer
+	for offset < len(data) {
+		if offset+4 > len(data) {
+			return nil, fmt.Errorf("siesta: truncated xerial-snappy chunk length")
+		}
+		chunkLen := int(binary.BigEndian.Uint32(data[offset:]))
+		offset += 4
+		if offset+chunkLen > len(data) {
+			return nil, fmt.Errorf("siesta: truncated xerial-snappy chunk")
+		}
+
+		chunk, err := snappy.Decode(nil, data[offset:offset+chunkLen])
+		if err != nil {
+			return nil, err
+		}
+		result.Write(chunk)
+		offset += chunkLen
+	}
+
+	return result.Bytes(), nil
+}
+
+// decompressInnerMessages decompresses a wrapper message's Value and hands the result to parseInner,
+// which decodes it as an inner MessageSet (Kafka 0.10+ semantics: the wrapper carries a single compressed
+// MessageSet whose own per-message offsets are relative offsets within the batch, counting up to the
+// wrapper message's own absolute offset). Mirrors the unwrapping SaramaClient.collectMessages already does
+// for Sarama's FetchResponseBlock.
+func decompressInnerMessages(attributes byte, wrapperOffset int64, value []byte, parseInner func([]byte) ([]*Message, error)) ([]*Message, error) {
+	decompressed, err := decompressPayload(attributes, value)
+	if err != nil {
+		return nil, err
+	}
+
+	innerMessages, err := parseInner(decompressed)
+	if err != nil {
+		return nil, err
+	}
+
+	// The last inner message's relative offset equals the wrapper's relative offset (len(innerMessages)-1),
+	// so baseOffset = wrapperOffset - (len(innerMessages)-1) recovers the absolute offset of the first
+	// inner message; every other inner message's absolute offset follows by adding its relative offset.
+	baseOffset := wrapperOffset - int64(len(innerMessages)-1)
+	for _, message := range innerMessages {
+		message.Offset = baseOffset + message.Offset
+	}
+
+	return innerMessages, nil
+}
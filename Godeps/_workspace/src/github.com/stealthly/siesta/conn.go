@@ -16,79 +16,278 @@ limitations under the License. */
 package siesta
 
 import (
+	"context"
+	"crypto/tls"
 	"net"
 	"sync"
 	"time"
 )
 
+// pooledConn wraps a connection a connectionPool hands out, tracking when it was last returned so the
+// reaper can evict connections that have sat idle longer than maxIdle. Borrow does not probe a pooled
+// connection before handing it out: one broken while idle (e.g. by a broker restart) is handed out as is
+// and is discarded only once its caller Returns it with an error. conn is a net.Conn rather than
+// a *net.TCPConn since an SSL/SASL_SSL connectStr wraps the dialed TCP connection in a *tls.Conn.
+type pooledConn struct {
+	conn     net.Conn
+	lastUsed time.Time
+}
+
+// Metrics receives counters from a connectionPool so they can be exported, e.g. as Prometheus gauges.
+// All methods must be safe to call concurrently.
+type Metrics interface {
+	IncBorrows()
+	IncWaits()
+	ObserveWaitDuration(d time.Duration)
+	IncEvictions()
+	SetActive(n int)
+	SetIdle(n int)
+}
+
+// noopMetrics is the default Metrics implementation used when a connectionPool is not given one.
+type noopMetrics struct{}
+
+func (noopMetrics) IncBorrows()                         {}
+func (noopMetrics) IncWaits()                           {}
+func (noopMetrics) ObserveWaitDuration(d time.Duration) {}
+func (noopMetrics) IncEvictions()                       {}
+func (noopMetrics) SetActive(n int)                     {}
+func (noopMetrics) SetIdle(n int)                       {}
+
 type connectionPool struct {
 	connectStr       string
 	size             int
 	conns            int
 	keepAlive        bool
 	keepAlivePeriod  time.Duration
-	connections      []*net.TCPConn
+	saslConfig       *SaslConfig
+	maxIdle          time.Duration
+	metrics          Metrics
+	idle             []*pooledConn
 	lock             sync.Mutex
 	connReleasedCond *sync.Cond
+	closed           chan struct{}
+	closeOnce        sync.Once
 }
 
-func newConnectionPool(connectStr string, size int, keepAlive bool, keepAlivePeriod time.Duration) *connectionPool {
+// newConnectionPool creates a connectionPool bounded at size live connections to connectStr, evicting
+// connections idle longer than maxIdle via a background reaper that wakes up every reapInterval. Pass a
+// nil metrics to disable metrics collection.
+func newConnectionPool(connectStr string, size int, keepAlive bool, keepAlivePeriod time.Duration, saslConfig *SaslConfig, maxIdle time.Duration, reapInterval time.Duration, metrics Metrics) *connectionPool {
+	if metrics == nil {
+		metrics = noopMetrics{}
+	}
+
 	pool := &connectionPool{
 		connectStr:      connectStr,
 		size:            size,
 		conns:           0,
 		keepAlive:       keepAlive,
 		keepAlivePeriod: keepAlivePeriod,
-		connections:     make([]*net.TCPConn, 0),
+		saslConfig:      saslConfig,
+		maxIdle:         maxIdle,
+		metrics:         metrics,
+		idle:            make([]*pooledConn, 0),
+		closed:          make(chan struct{}),
 	}
 
 	pool.connReleasedCond = sync.NewCond(&pool.lock)
 
+	if maxIdle > 0 && reapInterval > 0 {
+		go pool.reap(reapInterval)
+	}
+
 	return pool
 }
 
-func (this *connectionPool) Borrow() (conn *net.TCPConn, err error) {
-	inLock(&this.lock, func() {
-		for this.conns >= this.size && len(this.connections) == 0 {
-			this.connReleasedCond.Wait()
+// Borrow returns a pooled connection, dialing a new one if the pool has room, or blocking until one is
+// returned if it does not. Returns ctx.Err() if ctx is done before a connection becomes available.
+func (this *connectionPool) Borrow(ctx context.Context) (conn net.Conn, err error) {
+	start := time.Now()
+	waited := false
+
+	this.lock.Lock()
+	for this.conns >= this.size && len(this.idle) == 0 {
+		waited = true
+		this.metrics.IncWaits()
+		if !this.waitOrCancel(ctx) {
+			this.lock.Unlock()
+			return nil, ctx.Err()
 		}
+	}
 
-		if len(this.connections) > 0 {
-			conn = this.connections[0]
-			this.connections = this.connections[1:]
-		} else {
-			conn, err = this.connect()
-			if err != nil {
-				return
-			}
-			this.conns++
+	if len(this.idle) > 0 {
+		pooled := this.idle[0]
+		this.idle = this.idle[1:]
+		conn = pooled.conn
+		this.lock.Unlock()
+	} else {
+		this.conns++
+		this.lock.Unlock()
+
+		conn, err = this.connect()
+		if err != nil {
+			this.lock.Lock()
+			this.conns--
+			this.lock.Unlock()
+			return nil, err
 		}
-	})
-	return conn, err
+	}
+
+	this.metrics.IncBorrows()
+	this.updateGauges()
+	if waited {
+		this.metrics.ObserveWaitDuration(time.Since(start))
+	}
+	return conn, nil
 }
 
-func (this *connectionPool) Return(conn *net.TCPConn) {
-	inLock(&this.lock, func() {
-		if len(this.connections) < this.conns {
-			this.connections = append(this.connections, conn)
+// waitOrCancel waits on connReleasedCond, but also wakes up (and broadcasts, so other waiters re-check
+// too) once ctx is done. Must be called with this.lock held; returns with this.lock held either way,
+// though it may release and reacquire it more than once in between. Returns false if ctx ended the wait.
+func (this *connectionPool) waitOrCancel(ctx context.Context) bool {
+	if ctx.Done() == nil {
+		this.connReleasedCond.Wait()
+		return true
+	}
+
+	stopWatching := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		select {
+		case <-ctx.Done():
+			this.lock.Lock()
 			this.connReleasedCond.Broadcast()
+			this.lock.Unlock()
+		case <-stopWatching:
+		}
+	}()
+
+	this.connReleasedCond.Wait()
+	close(stopWatching)
+	// The watcher may be blocked acquiring this.lock to broadcast, so release it while waiting for done.
+	this.lock.Unlock()
+	<-done
+	this.lock.Lock()
+
+	return ctx.Err() == nil
+}
+
+// Return gives a connection back to the pool. If connErr is non-nil (the caller hit an I/O error using
+// this connection) the connection is closed and discarded instead of being pooled, since it is likely
+// broken (e.g. the broker it pointed at restarted).
+func (this *connectionPool) Return(conn net.Conn, connErr error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if connErr != nil {
+		conn.Close()
+		this.conns--
+		this.metrics.IncEvictions()
+		this.connReleasedCond.Broadcast()
+		this.updateGaugesLocked()
+		return
+	}
+
+	if len(this.idle) < this.conns {
+		this.idle = append(this.idle, &pooledConn{conn: conn, lastUsed: time.Now()})
+		this.connReleasedCond.Broadcast()
+	}
+	this.updateGaugesLocked()
+}
+
+// Close stops this pool's reaper goroutine and closes every currently idle connection. In-flight
+// (borrowed) connections are left for their callers to Return or close themselves.
+func (this *connectionPool) Close() {
+	this.closeOnce.Do(func() {
+		close(this.closed)
+
+		this.lock.Lock()
+		defer this.lock.Unlock()
+		for _, pooled := range this.idle {
+			pooled.conn.Close()
 		}
+		this.idle = nil
 	})
 }
 
-func (this *connectionPool) connect() (*net.TCPConn, error) {
+// reap periodically closes idle connections that have sat unused longer than maxIdle.
+func (this *connectionPool) reap(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			this.evictIdle()
+		case <-this.closed:
+			return
+		}
+	}
+}
+
+func (this *connectionPool) evictIdle() {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	cutoff := time.Now().Add(-this.maxIdle)
+	kept := this.idle[:0]
+	for _, pooled := range this.idle {
+		if pooled.lastUsed.Before(cutoff) {
+			pooled.conn.Close()
+			this.conns--
+			this.metrics.IncEvictions()
+		} else {
+			kept = append(kept, pooled)
+		}
+	}
+	this.idle = kept
+	this.updateGaugesLocked()
+}
+
+// updateGauges reports the current active/idle counts to this pool's Metrics.
+func (this *connectionPool) updateGauges() {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.updateGaugesLocked()
+}
+
+func (this *connectionPool) updateGaugesLocked() {
+	this.metrics.SetIdle(len(this.idle))
+	this.metrics.SetActive(this.conns - len(this.idle))
+}
+
+func (this *connectionPool) connect() (net.Conn, error) {
 	addr, err := net.ResolveTCPAddr("tcp", this.connectStr)
 	if err != nil {
 		return nil, err
 	}
-	conn, err := net.DialTCP("tcp", nil, addr)
+	tcpConn, err := net.DialTCP("tcp", nil, addr)
 	if err != nil {
 		return nil, err
 	}
 
 	if this.keepAlive {
-		conn.SetKeepAlive(this.keepAlive)
-		conn.SetKeepAlivePeriod(this.keepAlivePeriod)
+		tcpConn.SetKeepAlive(this.keepAlive)
+		tcpConn.SetKeepAlivePeriod(this.keepAlivePeriod)
+	}
+
+	var conn net.Conn = tcpConn
+	if this.saslConfig.tlsEnabled() {
+		tlsConn := tls.Client(tcpConn, this.saslConfig.TLSConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			tcpConn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	if this.saslConfig.enabled() {
+		if err := authenticate(conn, this.saslConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
 	}
 
 	return conn, nil
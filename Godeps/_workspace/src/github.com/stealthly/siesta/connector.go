@@ -0,0 +1,424 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package siesta
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+const (
+	fetchApiKey      = int16(1)
+	fetchApiVersion  = int16(0)
+	offsetApiKey     = int16(2)
+	offsetApiVersion = int16(0)
+
+	offsetOutOfRangeErrorCode = int16(1)
+)
+
+// LatestTime and EarliestTime are the special timestamp values GetAvailableOffset uses to ask for the
+// newest or oldest available offset, rather than the offset as of a particular wall-clock time.
+const (
+	LatestTime   int64 = -1
+	EarliestTime int64 = -2
+)
+
+// OffsetOutOfRange is returned by Consume when the requested offset falls outside the partition's
+// currently available range.
+var OffsetOutOfRange = fmt.Errorf("siesta: offset out of range")
+
+// Message is a single record returned by Connector.Consume.
+type Message struct {
+	Key       []byte
+	Value     []byte
+	Topic     string
+	Partition int32
+	Offset    int64
+}
+
+// ConnectorConfig holds the settings needed to construct a DefaultConnector.
+type ConnectorConfig struct {
+	BrokerList       []string
+	ClientId         string
+	ReadTimeout      time.Duration
+	WriteTimeout     time.Duration
+	ConnectTimeout   time.Duration
+	FetchSize        int32
+	SecurityProtocol string
+	SaslMechanism    string
+	SaslUsername     string
+	SaslPassword     string
+	TLSConfig        *tls.Config
+	PoolSize         int
+}
+
+// NewConnectorConfig returns a ConnectorConfig with sane defaults.
+func NewConnectorConfig() *ConnectorConfig {
+	return &ConnectorConfig{
+		ReadTimeout:    10 * time.Second,
+		WriteTimeout:   10 * time.Second,
+		ConnectTimeout: 10 * time.Second,
+		FetchSize:      1024 * 1024,
+		PoolSize:       5,
+	}
+}
+
+// Connector fetches messages and offsets from a Kafka cluster on behalf of LowLevelClient.
+type Connector interface {
+	// Consume fetches whatever messages are currently available for topic/partition starting at offset.
+	Consume(topic string, partition int32, offset int64) ([]*Message, error)
+
+	// GetAvailableOffset returns the earliest or latest available offset for topic/partition, depending on
+	// whether timestamp is EarliestTime or LatestTime.
+	GetAvailableOffset(topic string, partition int32, timestamp int64) (int64, error)
+
+	// Close gracefully shuts down this Connector, returning a channel that closes once shutdown completes.
+	Close() <-chan bool
+}
+
+// DefaultConnector implements Connector over a pooled connection to the first configured broker.
+// TODO: once metadata refresh is implemented, route each request to the partition's actual leader instead
+// of always using the first configured broker.
+type DefaultConnector struct {
+	config *ConnectorConfig
+	pool   *connectionPool
+}
+
+// NewDefaultConnector creates a DefaultConnector for config.
+func NewDefaultConnector(config *ConnectorConfig) (*DefaultConnector, error) {
+	if len(config.BrokerList) == 0 {
+		return nil, fmt.Errorf("no brokers configured")
+	}
+
+	saslConfig := &SaslConfig{
+		SecurityProtocol: config.SecurityProtocol,
+		Mechanism:        config.SaslMechanism,
+		Username:         config.SaslUsername,
+		Password:         config.SaslPassword,
+		TLSConfig:        config.TLSConfig,
+	}
+	pool := newConnectionPool(config.BrokerList[0], config.PoolSize, false, 0, saslConfig, 0, 0, nil)
+	return &DefaultConnector{config: config, pool: pool}, nil
+}
+
+// Consume fetches messages from topic/partition starting at offset, transparently decompressing and
+// unwrapping compressed message sets via decompressPayload/decompressInnerMessages.
+func (this *DefaultConnector) Consume(topic string, partition int32, offset int64) ([]*Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), this.config.ReadTimeout)
+	defer cancel()
+
+	conn, err := this.pool.Borrow(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	req := this.buildFetchRequest(topic, partition, offset)
+	if err := writeRequest(conn, req); err != nil {
+		this.pool.Return(conn, err)
+		return nil, err
+	}
+
+	resp, err := readResponse(conn)
+	if err != nil {
+		this.pool.Return(conn, err)
+		return nil, err
+	}
+	this.pool.Return(conn, nil)
+
+	return parseFetchResponse(resp, topic, partition)
+}
+
+// GetAvailableOffset returns the earliest or latest available offset for topic/partition.
+func (this *DefaultConnector) GetAvailableOffset(topic string, partition int32, timestamp int64) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), this.config.ReadTimeout)
+	defer cancel()
+
+	conn, err := this.pool.Borrow(ctx)
+	if err != nil {
+		return -1, err
+	}
+
+	req := this.buildOffsetRequest(topic, partition, timestamp)
+	if err := writeRequest(conn, req); err != nil {
+		this.pool.Return(conn, err)
+		return -1, err
+	}
+
+	resp, err := readResponse(conn)
+	if err != nil {
+		this.pool.Return(conn, err)
+		return -1, err
+	}
+	this.pool.Return(conn, nil)
+
+	return parseOffsetResponse(resp, topic, partition)
+}
+
+// Close gracefully shuts down this DefaultConnector's broker connection.
+func (this *DefaultConnector) Close() <-chan bool {
+	done := make(chan bool, 1)
+	this.pool.Close()
+	done <- true
+	return done
+}
+
+// buildFetchRequest encodes a FetchRequest (v0) asking for messages from a single topic/partition.
+func (this *DefaultConnector) buildFetchRequest(topic string, partition int32, offset int64) *bytes.Buffer {
+	req := &bytes.Buffer{}
+	binary.Write(req, binary.BigEndian, fetchApiKey)
+	binary.Write(req, binary.BigEndian, fetchApiVersion)
+	binary.Write(req, binary.BigEndian, int32(0)) // correlation id
+	writeShortString(req, this.config.ClientId)
+
+	binary.Write(req, binary.BigEndian, int32(-1))                                       // replica_id: -1 for a consumer
+	binary.Write(req, binary.BigEndian, int32(this.config.ReadTimeout/time.Millisecond)) // max_wait_time
+	binary.Write(req, binary.BigEndian, int32(1))                                        // min_bytes
+
+	binary.Write(req, binary.BigEndian, int32(1)) // topic_data array size
+	writeShortString(req, topic)
+
+	binary.Write(req, binary.BigEndian, int32(1)) // partition_data array size
+	binary.Write(req, binary.BigEndian, partition)
+	binary.Write(req, binary.BigEndian, offset)
+	binary.Write(req, binary.BigEndian, this.config.FetchSize)
+
+	return req
+}
+
+// parseFetchResponse decodes a FetchResponse (v0) and returns the decompressed messages for the single
+// topic/partition this connector ever requests.
+func parseFetchResponse(resp []byte, topic string, partition int32) ([]*Message, error) {
+	offset := 0
+	if offset+4 > len(resp) {
+		return nil, fmt.Errorf("siesta: malformed FetchResponse")
+	}
+	topicCount := int32(binary.BigEndian.Uint32(resp[offset:]))
+	offset += 4
+
+	for t := int32(0); t < topicCount; t++ {
+		if offset+2 > len(resp) {
+			return nil, fmt.Errorf("siesta: malformed FetchResponse")
+		}
+		topicLen := int(binary.BigEndian.Uint16(resp[offset:]))
+		offset += 2
+		if offset+topicLen+4 > len(resp) {
+			return nil, fmt.Errorf("siesta: malformed FetchResponse")
+		}
+		responseTopic := string(resp[offset : offset+topicLen])
+		offset += topicLen
+
+		partitionCount := int32(binary.BigEndian.Uint32(resp[offset:]))
+		offset += 4
+
+		for p := int32(0); p < partitionCount; p++ {
+			if offset+4+2+8+4 > len(resp) {
+				return nil, fmt.Errorf("siesta: malformed FetchResponse")
+			}
+			responsePartition := int32(binary.BigEndian.Uint32(resp[offset:]))
+			offset += 4
+			errorCode := int16(binary.BigEndian.Uint16(resp[offset:]))
+			offset += 2
+			offset += 8 // high_watermark
+			messageSetSize := int32(binary.BigEndian.Uint32(resp[offset:]))
+			offset += 4
+			if offset+int(messageSetSize) > len(resp) {
+				return nil, fmt.Errorf("siesta: malformed FetchResponse")
+			}
+			messageSetBytes := resp[offset : offset+int(messageSetSize)]
+			offset += int(messageSetSize)
+
+			if responseTopic != topic || responsePartition != partition {
+				continue
+			}
+			if errorCode == offsetOutOfRangeErrorCode {
+				return nil, OffsetOutOfRange
+			}
+			if errorCode != 0 {
+				return nil, fmt.Errorf("siesta: fetch %s:%d failed with error code %d", topic, partition, errorCode)
+			}
+			return parseMessageSet(messageSetBytes, topic, partition)
+		}
+	}
+
+	return nil, fmt.Errorf("siesta: FetchResponse did not include %s:%d", topic, partition)
+}
+
+// parseMessageSet decodes a Kafka MessageSet, decompressing and recursively unwrapping any compressed
+// wrapper messages via decompressInnerMessages. A trailing partial message (the broker filled the fetch
+// response up to FetchSize and cut a message in half) is silently dropped, as Kafka's own wire format
+// expects consumers to do.
+func parseMessageSet(data []byte, topic string, partition int32) ([]*Message, error) {
+	messages := make([]*Message, 0)
+	offset := 0
+	for offset < len(data) {
+		if offset+8+4 > len(data) {
+			break
+		}
+		messageOffset := int64(binary.BigEndian.Uint64(data[offset:]))
+		offset += 8
+		messageSize := int32(binary.BigEndian.Uint32(data[offset:]))
+		offset += 4
+		if messageSize < 0 || offset+int(messageSize) > len(data) {
+			break
+		}
+		messageBytes := data[offset : offset+int(messageSize)]
+		offset += int(messageSize)
+
+		parsed, err := parseMessage(messageBytes, messageOffset, topic, partition)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, parsed...)
+	}
+	return messages, nil
+}
+
+// parseMessage decodes a single Kafka message (crc, magic byte, attributes, optional v1 timestamp, key,
+// value), decompressing value and recursing into it via decompressInnerMessages when attributes marks it
+// as a compressed wrapper message.
+func parseMessage(data []byte, messageOffset int64, topic string, partition int32) ([]*Message, error) {
+	if len(data) < 4+1+1 {
+		return nil, fmt.Errorf("siesta: truncated message")
+	}
+	pos := 4 // crc, not verified
+	magic := int8(data[pos])
+	pos++
+	attributes := data[pos]
+	pos++
+	if magic >= 1 {
+		if pos+8 > len(data) {
+			return nil, fmt.Errorf("siesta: truncated message")
+		}
+		pos += 8 // timestamp, unused
+	}
+
+	key, pos, err := readMessageBytes(data, pos)
+	if err != nil {
+		return nil, err
+	}
+	value, pos, err := readMessageBytes(data, pos)
+	if err != nil {
+		return nil, err
+	}
+
+	if messageCodec(attributes) == compressionNone {
+		return []*Message{{Key: key, Value: value, Topic: topic, Partition: partition, Offset: messageOffset}}, nil
+	}
+
+	return decompressInnerMessages(attributes, messageOffset, value, func(inner []byte) ([]*Message, error) {
+		return parseMessageSet(inner, topic, partition)
+	})
+}
+
+// readMessageBytes reads a Kafka protocol nullable byte array starting at pos, returning its contents (nil
+// if the length was -1) and the position immediately after it.
+func readMessageBytes(data []byte, pos int) ([]byte, int, error) {
+	if pos+4 > len(data) {
+		return nil, 0, fmt.Errorf("siesta: truncated message")
+	}
+	length := int32(binary.BigEndian.Uint32(data[pos:]))
+	pos += 4
+	if length < 0 {
+		return nil, pos, nil
+	}
+	if pos+int(length) > len(data) {
+		return nil, 0, fmt.Errorf("siesta: truncated message")
+	}
+	return data[pos : pos+int(length)], pos + int(length), nil
+}
+
+// buildOffsetRequest encodes a ListOffsetRequest (v0) asking for a single offset of topic/partition as of
+// timestamp.
+func (this *DefaultConnector) buildOffsetRequest(topic string, partition int32, timestamp int64) *bytes.Buffer {
+	req := &bytes.Buffer{}
+	binary.Write(req, binary.BigEndian, offsetApiKey)
+	binary.Write(req, binary.BigEndian, offsetApiVersion)
+	binary.Write(req, binary.BigEndian, int32(0)) // correlation id
+	writeShortString(req, this.config.ClientId)
+
+	binary.Write(req, binary.BigEndian, int32(-1)) // replica_id: -1 for a consumer
+
+	binary.Write(req, binary.BigEndian, int32(1)) // topic_data array size
+	writeShortString(req, topic)
+
+	binary.Write(req, binary.BigEndian, int32(1)) // partition_data array size
+	binary.Write(req, binary.BigEndian, partition)
+	binary.Write(req, binary.BigEndian, timestamp)
+	binary.Write(req, binary.BigEndian, int32(1)) // max_num_offsets
+
+	return req
+}
+
+// parseOffsetResponse decodes a ListOffsetResponse (v0) and returns the single offset reported for the
+// topic/partition this connector ever requests.
+func parseOffsetResponse(resp []byte, topic string, partition int32) (int64, error) {
+	offset := 0
+	if offset+4 > len(resp) {
+		return -1, fmt.Errorf("siesta: malformed OffsetResponse")
+	}
+	topicCount := int32(binary.BigEndian.Uint32(resp[offset:]))
+	offset += 4
+
+	for t := int32(0); t < topicCount; t++ {
+		if offset+2 > len(resp) {
+			return -1, fmt.Errorf("siesta: malformed OffsetResponse")
+		}
+		topicLen := int(binary.BigEndian.Uint16(resp[offset:]))
+		offset += 2
+		if offset+topicLen+4 > len(resp) {
+			return -1, fmt.Errorf("siesta: malformed OffsetResponse")
+		}
+		responseTopic := string(resp[offset : offset+topicLen])
+		offset += topicLen
+
+		partitionCount := int32(binary.BigEndian.Uint32(resp[offset:]))
+		offset += 4
+
+		for p := int32(0); p < partitionCount; p++ {
+			if offset+4+2+4 > len(resp) {
+				return -1, fmt.Errorf("siesta: malformed OffsetResponse")
+			}
+			responsePartition := int32(binary.BigEndian.Uint32(resp[offset:]))
+			offset += 4
+			errorCode := int16(binary.BigEndian.Uint16(resp[offset:]))
+			offset += 2
+			offsetCount := int32(binary.BigEndian.Uint32(resp[offset:]))
+			offset += 4
+			if offsetCount < 0 || offset+int(offsetCount)*8 > len(resp) {
+				return -1, fmt.Errorf("siesta: malformed OffsetResponse")
+			}
+			firstOffset := int64(-1)
+			if offsetCount > 0 {
+				firstOffset = int64(binary.BigEndian.Uint64(resp[offset:]))
+			}
+			offset += int(offsetCount) * 8
+
+			if responseTopic != topic || responsePartition != partition {
+				continue
+			}
+			if errorCode != 0 {
+				return -1, fmt.Errorf("siesta: offset lookup for %s:%d failed with error code %d", topic, partition, errorCode)
+			}
+			return firstOffset, nil
+		}
+	}
+
+	return -1, fmt.Errorf("siesta: OffsetResponse did not include %s:%d", topic, partition)
+}
@@ -0,0 +1,83 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package siesta
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PrometheusMetrics implements Metrics by registering a connectionPool's counters/gauges with a
+// Prometheus registry, labeled by the broker the pool connects to.
+type PrometheusMetrics struct {
+	borrowsTotal   prometheus.Counter
+	waitsTotal     prometheus.Counter
+	waitDuration   prometheus.Histogram
+	evictionsTotal prometheus.Counter
+	active         prometheus.Gauge
+	idle           prometheus.Gauge
+}
+
+// NewPrometheusMetrics creates and registers a PrometheusMetrics for the given broker against registry.
+func NewPrometheusMetrics(registry prometheus.Registerer, broker string) *PrometheusMetrics {
+	labels := prometheus.Labels{"broker": broker}
+
+	metrics := &PrometheusMetrics{
+		borrowsTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        "siesta_connection_pool_borrows_total",
+			Help:        "Total number of connections borrowed from the pool.",
+			ConstLabels: labels,
+		}),
+		waitsTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        "siesta_connection_pool_waits_total",
+			Help:        "Total number of times a Borrow call had to wait for a connection.",
+			ConstLabels: labels,
+		}),
+		waitDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:        "siesta_connection_pool_wait_duration_seconds",
+			Help:        "Time spent waiting for a connection to become available.",
+			ConstLabels: labels,
+		}),
+		evictionsTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        "siesta_connection_pool_evictions_total",
+			Help:        "Total number of connections closed and discarded instead of being pooled.",
+			ConstLabels: labels,
+		}),
+		active: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:        "siesta_connection_pool_active",
+			Help:        "Number of connections currently borrowed.",
+			ConstLabels: labels,
+		}),
+		idle: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:        "siesta_connection_pool_idle",
+			Help:        "Number of connections currently idle in the pool.",
+			ConstLabels: labels,
+		}),
+	}
+
+	registry.MustRegister(metrics.borrowsTotal, metrics.waitsTotal, metrics.waitDuration, metrics.evictionsTotal, metrics.active, metrics.idle)
+	return metrics
+}
+
+func (this *PrometheusMetrics) IncBorrows() { this.borrowsTotal.Inc() }
+func (this *PrometheusMetrics) IncWaits()   { this.waitsTotal.Inc() }
+func (this *PrometheusMetrics) ObserveWaitDuration(d time.Duration) {
+	this.waitDuration.Observe(d.Seconds())
+}
+func (this *PrometheusMetrics) IncEvictions()   { this.evictionsTotal.Inc() }
+func (this *PrometheusMetrics) SetActive(n int) { this.active.Set(float64(n)) }
+func (this *PrometheusMetrics) SetIdle(n int)   { this.idle.Set(float64(n)) }
@@ -0,0 +1,374 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package siesta
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"time"
+)
+
+const (
+	produceApiKey     = int16(0)
+	produceApiVersion = int16(0)
+
+	metadataApiKey     = int16(3)
+	metadataApiVersion = int16(0)
+)
+
+// ProducerConfig holds the settings needed to construct a KafkaProducer.
+type ProducerConfig struct {
+	BrokerList      []string
+	ClientID        string
+	RequiredAcks    int16
+	AckTimeoutMs    int32
+	ConnectTimeout  time.Duration
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	KeepAlive       bool
+	KeepAlivePeriod time.Duration
+	PoolSize        int
+	SaslConfig      *SaslConfig
+}
+
+// NewProducerConfig returns a ProducerConfig with the same sensible defaults NewConnectorConfig uses on
+// the consume side.
+func NewProducerConfig() *ProducerConfig {
+	return &ProducerConfig{
+		RequiredAcks:   1,
+		AckTimeoutMs:   5000,
+		ConnectTimeout: 10 * time.Second,
+		ReadTimeout:    10 * time.Second,
+		WriteTimeout:   10 * time.Second,
+		PoolSize:       5,
+	}
+}
+
+// Producer sends records to a Kafka cluster.
+type Producer interface {
+	// Send produces a single record to topic, pinning it to partition. A negative partition leaves
+	// partition assignment to the caller's own Partitioner and is sent to the broker unchanged, so callers
+	// should resolve a concrete partition before calling Send.
+	Send(topic string, partition int32, key, value []byte) (assignedPartition int32, offset int64, err error)
+
+	// PartitionCount returns the number of partitions topic currently has, so a caller's own Partitioner
+	// can pick one before calling Send.
+	PartitionCount(topic string) (int32, error)
+
+	// Close gracefully shuts down this Producer, returning a channel that closes once shutdown completes.
+	Close() <-chan bool
+}
+
+// ConnectorFactory builds the connection a KafkaProducer uses to reach the cluster.
+type ConnectorFactory func(config *ProducerConfig) (*connectionPool, error)
+
+// NewSiestaConnector is the default ConnectorFactory: a connectionPool pointed at the first broker in
+// config.BrokerList.
+// TODO: once metadata refresh is implemented, route each Send to the partition's actual leader instead of
+// always using the first configured broker.
+func NewSiestaConnector(config *ProducerConfig) (*connectionPool, error) {
+	if len(config.BrokerList) == 0 {
+		return nil, fmt.Errorf("no brokers configured")
+	}
+	return newConnectionPool(config.BrokerList[0], config.PoolSize, config.KeepAlive, config.KeepAlivePeriod, config.SaslConfig, 0, 0, nil), nil
+}
+
+// KafkaProducer implements Producer by issuing raw ProduceRequests over a pooled connection.
+type KafkaProducer struct {
+	config *ProducerConfig
+	pool   *connectionPool
+}
+
+// NewKafkaProducer creates a KafkaProducer for config, obtaining its broker connection via newConnector.
+func NewKafkaProducer(config *ProducerConfig, newConnector ConnectorFactory) (*KafkaProducer, error) {
+	pool, err := newConnector(config)
+	if err != nil {
+		return nil, err
+	}
+	return &KafkaProducer{config: config, pool: pool}, nil
+}
+
+// Send produces a single record to topic and partition, returning the partition and offset Kafka assigned
+// it. If config.RequiredAcks is 0, Kafka sends no response and this always returns (partition, -1, nil).
+func (this *KafkaProducer) Send(topic string, partition int32, key, value []byte) (int32, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), this.config.WriteTimeout)
+	defer cancel()
+
+	conn, err := this.pool.Borrow(ctx)
+	if err != nil {
+		return -1, -1, err
+	}
+
+	req := this.buildProduceRequest(topic, partition, key, value)
+	if err := writeRequest(conn, req); err != nil {
+		this.pool.Return(conn, err)
+		return -1, -1, err
+	}
+
+	if this.config.RequiredAcks == 0 {
+		this.pool.Return(conn, nil)
+		return partition, -1, nil
+	}
+
+	resp, err := readResponse(conn)
+	if err != nil {
+		this.pool.Return(conn, err)
+		return -1, -1, err
+	}
+	this.pool.Return(conn, nil)
+
+	return parseProduceResponse(resp, topic, partition)
+}
+
+// PartitionCount returns the number of partitions topic currently has, via a MetadataRequest.
+func (this *KafkaProducer) PartitionCount(topic string) (int32, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), this.config.ReadTimeout)
+	defer cancel()
+
+	conn, err := this.pool.Borrow(ctx)
+	if err != nil {
+		return -1, err
+	}
+
+	req := this.buildMetadataRequest(topic)
+	if err := writeRequest(conn, req); err != nil {
+		this.pool.Return(conn, err)
+		return -1, err
+	}
+
+	resp, err := readResponse(conn)
+	if err != nil {
+		this.pool.Return(conn, err)
+		return -1, err
+	}
+	this.pool.Return(conn, nil)
+
+	return parsePartitionCount(resp, topic)
+}
+
+// Close gracefully shuts down this KafkaProducer's broker connection.
+func (this *KafkaProducer) Close() <-chan bool {
+	done := make(chan bool, 1)
+	this.pool.Close()
+	done <- true
+	return done
+}
+
+// buildMetadataRequest encodes a MetadataRequest (v0) asking for a single topic's partition layout.
+func (this *KafkaProducer) buildMetadataRequest(topic string) *bytes.Buffer {
+	req := &bytes.Buffer{}
+	binary.Write(req, binary.BigEndian, metadataApiKey)
+	binary.Write(req, binary.BigEndian, metadataApiVersion)
+	binary.Write(req, binary.BigEndian, int32(0)) // correlation id
+	writeShortString(req, this.config.ClientID)
+
+	binary.Write(req, binary.BigEndian, int32(1)) // topics array size
+	writeShortString(req, topic)
+
+	return req
+}
+
+// parsePartitionCount decodes a MetadataResponse (v0), skipping over the broker list, and returns the
+// number of partitions reported for topic.
+func parsePartitionCount(resp []byte, topic string) (int32, error) {
+	offset := 0
+	if offset+4 > len(resp) {
+		return -1, fmt.Errorf("malformed MetadataResponse")
+	}
+	brokerCount := int32(binary.BigEndian.Uint32(resp[offset:]))
+	offset += 4
+	for i := int32(0); i < brokerCount; i++ {
+		if offset+4 > len(resp) {
+			return -1, fmt.Errorf("malformed MetadataResponse")
+		}
+		offset += 4 // node_id
+		if offset+2 > len(resp) {
+			return -1, fmt.Errorf("malformed MetadataResponse")
+		}
+		hostLen := int(binary.BigEndian.Uint16(resp[offset:]))
+		offset += 2 + hostLen
+		offset += 4 // port
+	}
+
+	if offset+4 > len(resp) {
+		return -1, fmt.Errorf("malformed MetadataResponse")
+	}
+	topicCount := int32(binary.BigEndian.Uint32(resp[offset:]))
+	offset += 4
+
+	for i := int32(0); i < topicCount; i++ {
+		if offset+2+2 > len(resp) {
+			return -1, fmt.Errorf("malformed MetadataResponse")
+		}
+		topicErrorCode := int16(binary.BigEndian.Uint16(resp[offset:]))
+		offset += 2
+		topicNameLen := int(binary.BigEndian.Uint16(resp[offset:]))
+		offset += 2
+		if offset+topicNameLen+4 > len(resp) {
+			return -1, fmt.Errorf("malformed MetadataResponse")
+		}
+		topicName := string(resp[offset : offset+topicNameLen])
+		offset += topicNameLen
+
+		partitionCount := int32(binary.BigEndian.Uint32(resp[offset:]))
+		offset += 4
+
+		if topicName != topic {
+			for p := int32(0); p < partitionCount; p++ {
+				var err error
+				offset, err = skipPartitionMetadata(resp, offset)
+				if err != nil {
+					return -1, err
+				}
+			}
+			continue
+		}
+
+		if topicErrorCode != 0 {
+			return -1, fmt.Errorf("MetadataResponse reported error code %d for topic %s", topicErrorCode, topic)
+		}
+		return partitionCount, nil
+	}
+
+	return -1, fmt.Errorf("MetadataResponse did not include topic %s", topic)
+}
+
+// skipPartitionMetadata advances past a single partition_metadata entry, returning the new offset.
+func skipPartitionMetadata(resp []byte, offset int) (int, error) {
+	if offset+2+4+4+4 > len(resp) {
+		return 0, fmt.Errorf("malformed MetadataResponse")
+	}
+	offset += 2 // partition_error_code
+	offset += 4 // partition_id
+	offset += 4 // leader
+
+	replicaCount := int32(binary.BigEndian.Uint32(resp[offset:]))
+	offset += 4 + int(replicaCount)*4
+
+	if offset+4 > len(resp) {
+		return 0, fmt.Errorf("malformed MetadataResponse")
+	}
+	isrCount := int32(binary.BigEndian.Uint32(resp[offset:]))
+	offset += 4 + int(isrCount)*4
+
+	return offset, nil
+}
+
+// buildProduceRequest encodes a ProduceRequest (v0) carrying a single message for topic/partition.
+func (this *KafkaProducer) buildProduceRequest(topic string, partition int32, key, value []byte) *bytes.Buffer {
+	req := &bytes.Buffer{}
+	binary.Write(req, binary.BigEndian, produceApiKey)
+	binary.Write(req, binary.BigEndian, produceApiVersion)
+	binary.Write(req, binary.BigEndian, int32(0)) // correlation id
+	writeShortString(req, this.config.ClientID)
+
+	binary.Write(req, binary.BigEndian, this.config.RequiredAcks)
+	binary.Write(req, binary.BigEndian, this.config.AckTimeoutMs)
+
+	binary.Write(req, binary.BigEndian, int32(1)) // topic_data array size
+	writeShortString(req, topic)
+
+	binary.Write(req, binary.BigEndian, int32(1)) // partition_data array size
+	binary.Write(req, binary.BigEndian, partition)
+
+	messageSet := encodeMessageSet(key, value)
+	binary.Write(req, binary.BigEndian, int32(len(messageSet)))
+	req.Write(messageSet)
+
+	return req
+}
+
+// encodeMessageSet encodes a single uncompressed message (magic byte 0) as a one-element Kafka MessageSet.
+func encodeMessageSet(key, value []byte) []byte {
+	message := &bytes.Buffer{}
+	binary.Write(message, binary.BigEndian, int8(0)) // magic byte
+	binary.Write(message, binary.BigEndian, int8(0)) // attributes: no compression
+	writeNullableBytes(message, key)
+	writeNullableBytes(message, value)
+
+	crc := crc32.ChecksumIEEE(message.Bytes())
+
+	set := &bytes.Buffer{}
+	binary.Write(set, binary.BigEndian, int64(0)) // offset, ignored by the broker on produce
+	binary.Write(set, binary.BigEndian, int32(4+message.Len()))
+	binary.Write(set, binary.BigEndian, crc)
+	set.Write(message.Bytes())
+
+	return set.Bytes()
+}
+
+// writeNullableBytes writes a Kafka protocol nullable byte array: a 4-byte length prefix (-1 for nil)
+// followed by the bytes themselves.
+func writeNullableBytes(buf *bytes.Buffer, data []byte) {
+	if data == nil {
+		binary.Write(buf, binary.BigEndian, int32(-1))
+		return
+	}
+	binary.Write(buf, binary.BigEndian, int32(len(data)))
+	buf.Write(data)
+}
+
+// parseProduceResponse decodes a ProduceResponse (v0) carrying the single topic/partition this producer
+// ever requests, returning the partition and base offset the broker assigned the message.
+func parseProduceResponse(resp []byte, topic string, partition int32) (int32, int64, error) {
+	if len(resp) < 4 {
+		return -1, -1, fmt.Errorf("malformed ProduceResponse")
+	}
+	offset := 0
+	topicCount := int32(binary.BigEndian.Uint32(resp[offset:]))
+	offset += 4
+	if topicCount < 1 {
+		return -1, -1, fmt.Errorf("ProduceResponse contained no topics")
+	}
+
+	if offset+2 > len(resp) {
+		return -1, -1, fmt.Errorf("malformed ProduceResponse")
+	}
+	topicLen := int(binary.BigEndian.Uint16(resp[offset:]))
+	offset += 2
+	if offset+topicLen+4 > len(resp) {
+		return -1, -1, fmt.Errorf("malformed ProduceResponse")
+	}
+	responseTopic := string(resp[offset : offset+topicLen])
+	offset += topicLen
+
+	partitionCount := int32(binary.BigEndian.Uint32(resp[offset:]))
+	offset += 4
+	if partitionCount < 1 {
+		return -1, -1, fmt.Errorf("ProduceResponse for %s contained no partitions", responseTopic)
+	}
+	if offset+14 > len(resp) {
+		return -1, -1, fmt.Errorf("malformed ProduceResponse")
+	}
+
+	responsePartition := int32(binary.BigEndian.Uint32(resp[offset:]))
+	offset += 4
+	errorCode := int16(binary.BigEndian.Uint16(resp[offset:]))
+	offset += 2
+	baseOffset := int64(binary.BigEndian.Uint64(resp[offset:]))
+
+	if responseTopic != topic || responsePartition != partition {
+		return -1, -1, fmt.Errorf("ProduceResponse for %s:%d does not match requested %s:%d", responseTopic, responsePartition, topic, partition)
+	}
+	if errorCode != 0 {
+		return -1, -1, fmt.Errorf("produce to %s:%d failed with error code %d", topic, partition, errorCode)
+	}
+
+	return responsePartition, baseOffset, nil
+}
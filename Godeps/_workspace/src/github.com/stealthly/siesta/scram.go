@@ -0,0 +1,38 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package siesta
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+
+	"github.com/stealthly/scram"
+)
+
+// scramClient drives one RFC 5802 SCRAM-SHA-256/SCRAM-SHA-512 client conversation via the shared
+// scram.Client: client-first-message, client-final-message (once the salt and iteration count are
+// known), and verification of the server's final signature. Used by authenticateScram to authenticate
+// a freshly dialed broker connection.
+type scramClient = scram.Client
+
+// newScramClientFor returns a scramClient for the given SASL mechanism name ("SCRAM-SHA-256" or
+// "SCRAM-SHA-512").
+func newScramClientFor(mechanism string) *scramClient {
+	if mechanism == "SCRAM-SHA-512" {
+		return scram.NewClient(sha512.New)
+	}
+	return scram.NewClient(sha256.New)
+}
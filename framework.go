@@ -1,16 +1,17 @@
+//go:build scheduler
 // +build scheduler
 
 package main
 
 import (
-	kafka "github.com/stealthly/go_kafka_client"
-	mesos "github.com/stealthly/go-kafka/mesos"
+	"flag"
+	"fmt"
+	"github.com/golang/protobuf/proto"
 	"github.com/mesos/mesos-go/mesosproto"
 	"github.com/mesos/mesos-go/scheduler"
-	"github.com/golang/protobuf/proto"
+	mesos "github.com/stealthly/go-kafka/mesos"
+	kafka "github.com/stealthly/go_kafka_client"
 	"net/http"
-	"flag"
-	"fmt"
 	"os"
 	"strings"
 )
@@ -24,6 +25,7 @@ var executorBinaryName = flag.String("executor.name", "executor", "Executor bina
 var zookeeper = flag.String("zookeeper", "", "Zookeeper connection string separated by comma.")
 var whitelist = flag.String("whitelist", "", "Whitelist of topics to consume.")
 var blacklist = flag.String("blacklist", "", "Blacklist of topics to consume.")
+var scrapeConfigFile = flag.String("scrape.config.file", "", "Path to a YAML scrape config file describing brokers/topics/relabeling declaratively, as an alternative to -whitelist/-blacklist.")
 
 func parseAndValidateSchedulerArgs() {
 	flag.Parse()
@@ -33,16 +35,16 @@ func parseAndValidateSchedulerArgs() {
 		os.Exit(1)
 	}
 
-	if *whitelist == "" && *blacklist == "" {
-		fmt.Println("Whitelist or blacklist of topics to consume is required.")
+	if *whitelist == "" && *blacklist == "" && *scrapeConfigFile == "" {
+		fmt.Println("Whitelist, blacklist or scrape config file of topics to consume is required.")
 		os.Exit(1)
 	}
 }
 
 func startArtifactServer() {
 	http.HandleFunc("/executor", func(w http.ResponseWriter, r *http.Request) {
-			http.ServeFile(w, r, *executorBinaryName)
-		})
+		http.ServeFile(w, r, *executorBinaryName)
+	})
 	http.ListenAndServe(fmt.Sprintf(":%d", *artifactServerPort), nil)
 }
 
@@ -57,20 +59,35 @@ func main() {
 		Name: proto.String("Go Kafka Client Framework"),
 	}
 
-	var filter kafka.TopicFilter
-	if *whitelist != "" {
-		filter = kafka.NewWhiteList(*whitelist)
-	} else {
-		filter = kafka.NewBlackList(*blacklist)
-	}
-
 	schedulerConfig := mesos.NewSchedulerConfig()
 	schedulerConfig.CpuPerTask = *cpuPerConsumer
 	schedulerConfig.MemPerTask = *memPerConsumer
-	schedulerConfig.Filter = filter
 	schedulerConfig.Zookeeper = strings.Split(*zookeeper, ",")
 	schedulerConfig.ExecutorBinaryName = *executorBinaryName
 	schedulerConfig.ArtifactServerPort = *artifactServerPort
+
+	if *scrapeConfigFile != "" {
+		scrapeConfig, err := mesos.LoadScrapeConfigFile(*scrapeConfigFile)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		for _, s := range scrapeConfig.ScrapeConfigs {
+			if _, err := s.ConsumerConfigs(); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		}
+		schedulerConfig.ScrapeConfigFile = *scrapeConfigFile
+	} else {
+		var filter kafka.TopicFilter
+		if *whitelist != "" {
+			filter = kafka.NewWhiteList(*whitelist)
+		} else {
+			filter = kafka.NewBlackList(*blacklist)
+		}
+		schedulerConfig.Filter = filter
+	}
 	consumerScheduler, err := mesos.NewScheduler(schedulerConfig)
 	if err != nil {
 		fmt.Println(err)
@@ -86,4 +103,4 @@ func main() {
 	if stat, err := driver.Run(); err != nil {
 		fmt.Println("Framework stopped with status %s and error: %s\n", stat.String(), err.Error())
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,26 @@
+package mesos
+
+import "regexp"
+
+// regexpMatchString reports whether pattern matches anywhere in s.
+func regexpMatchString(pattern, s string) (bool, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, err
+	}
+	return re.MatchString(s), nil
+}
+
+// regexpReplace anchors pattern against the whole of s (Prometheus relabeling semantics: the regex must
+// match the entire joined source value, not just a substring) and, on a match, returns replacement with
+// any capture group references (e.g. "$1") substituted in.
+func regexpReplace(pattern, s, replacement string) (result string, matched bool, err error) {
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return "", false, err
+	}
+	if !re.MatchString(s) {
+		return "", false, nil
+	}
+	return re.ReplaceAllString(s, replacement), true, nil
+}
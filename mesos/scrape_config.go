@@ -0,0 +1,263 @@
+package mesos
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+	kafka "github.com/stealthly/go_kafka_client"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// metaLabel prefixes, mirroring Promtail's Kafka target labels: metadata about where a message came from
+// that relabel_configs can map onto arbitrary output labels.
+const (
+	MetaLabelTopic      = "__meta_kafka_topic"
+	MetaLabelPartition  = "__meta_kafka_partition"
+	MetaLabelGroupID    = "__meta_kafka_group_id"
+	MetaLabelKey        = "__meta_kafka_key"
+	MetaLabelMemberID   = "__meta_kafka_member_id"
+	MetaLabelScrapeTime = "__meta_kafka_scrape_time"
+)
+
+// RelabelConfig maps Kafka message metadata onto output labels attached to each consumed Message, the
+// same shape Promtail/Prometheus scrape configs use for their own relabel_configs.
+type RelabelConfig struct {
+	SourceLabels []string `yaml:"source_labels"`
+	Separator    string   `yaml:"separator,omitempty"`
+	Regex        string   `yaml:"regex,omitempty"`
+	TargetLabel  string   `yaml:"target_label"`
+	Replacement  string   `yaml:"replacement,omitempty"`
+}
+
+// TopicMatcher is a single entry of a ScrapeConfig's topics list: either a literal topic name, or (when
+// prefixed with "^" in the YAML) a regex matched against available topic names.
+type TopicMatcher struct {
+	Literal string
+	Regex   string
+}
+
+// UnmarshalYAML parses a topics list entry, treating a leading "^" as marking the entry as a regex.
+func (this *TopicMatcher) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var raw string
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+	if strings.HasPrefix(raw, "^") {
+		this.Regex = raw
+	} else {
+		this.Literal = raw
+	}
+	return nil
+}
+
+// ScrapeConfig is a single Kafka-source scrape target, analogous to a Promtail scrape_config stanza:
+// which brokers/group/topics to consume from, and how to relabel each consumed Message.
+type ScrapeConfig struct {
+	JobName              string          `yaml:"job_name"`
+	Brokers              []string        `yaml:"brokers"`
+	GroupID              string          `yaml:"group_id"`
+	Topics               []TopicMatcher  `yaml:"topics"`
+	UseIncomingTimestamp bool            `yaml:"use_incoming_timestamp"`
+	RelabelConfigs       []RelabelConfig `yaml:"relabel_configs"`
+}
+
+// ScrapeConfigFile is the root of a SchedulerConfig.ScrapeConfigFile YAML document.
+type ScrapeConfigFile struct {
+	ScrapeConfigs []ScrapeConfig `yaml:"scrape_configs"`
+}
+
+// LoadScrapeConfigFile parses the YAML scrape config at path.
+func LoadScrapeConfigFile(path string) (*ScrapeConfigFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &ScrapeConfigFile{}
+	if err := yaml.Unmarshal(data, file); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// resolveTopics returns every topic this ScrapeConfig selects: literal topics taken as-is, plus, if any
+// matcher is a regex, every topic in the live cluster's topic list (fetched from Brokers) that matches one
+// of this ScrapeConfig's "^regex" entries.
+func (this *ScrapeConfig) resolveTopics() ([]string, error) {
+	seen := make(map[string]bool)
+	topics := make([]string, 0, len(this.Topics))
+	hasRegex := false
+	for _, matcher := range this.Topics {
+		if matcher.Literal != "" && !seen[matcher.Literal] {
+			seen[matcher.Literal] = true
+			topics = append(topics, matcher.Literal)
+		}
+		if matcher.Regex != "" {
+			hasRegex = true
+		}
+	}
+	if !hasRegex {
+		return topics, nil
+	}
+
+	if len(this.Brokers) == 0 {
+		return nil, fmt.Errorf("scrape config %q has a regex topic matcher but no brokers to discover topics from", this.JobName)
+	}
+
+	client, err := sarama.NewClient(this.Brokers, sarama.NewConfig())
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	clusterTopics, err := client.Topics()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, topic := range clusterTopics {
+		if seen[topic] {
+			continue
+		}
+		matched, err := this.matchesTopic(topic)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			seen[topic] = true
+			topics = append(topics, topic)
+		}
+	}
+	return topics, nil
+}
+
+// TopicConsumerConfig pairs a single topic this ScrapeConfig consumes with the kafka.ConsumerConfig an
+// executor should use to fetch it. A LowLevelClient is created per TopicConsumerConfig, with Fetch called
+// against Topic directly, so the topic lives alongside the config rather than inside it.
+type TopicConsumerConfig struct {
+	Topic  string
+	Config *kafka.ConsumerConfig
+}
+
+// ConsumerConfigs builds one TopicConsumerConfig per topic this ScrapeConfig selects (see resolveTopics).
+func (this *ScrapeConfig) ConsumerConfigs() ([]*TopicConsumerConfig, error) {
+	topics, err := this.resolveTopics()
+	if err != nil {
+		return nil, err
+	}
+
+	configs := make([]*TopicConsumerConfig, 0, len(topics))
+	for _, topic := range topics {
+		config := kafka.NewConsumerConfig()
+		config.Groupid = this.GroupID
+		configs = append(configs, &TopicConsumerConfig{Topic: topic, Config: config})
+	}
+	return configs, nil
+}
+
+// matchesTopic reports whether topic is selected by this ScrapeConfig's topics list, either as a literal
+// name or via one of its "^regex" entries.
+func (this *ScrapeConfig) matchesTopic(topic string) (bool, error) {
+	for _, matcher := range this.Topics {
+		if matcher.Literal != "" && matcher.Literal == topic {
+			return true, nil
+		}
+		if matcher.Regex != "" {
+			matched, err := regexpMatchString(matcher.Regex, topic)
+			if err != nil {
+				return false, err
+			}
+			if matched {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// ApplyRelabeling computes the output labels for a message with the given metadata, following this
+// ScrapeConfig's relabel_configs in order: each rule joins its source_labels with separator (default
+// ";"), matches the result against regex (default matches everything), and on a match sets target_label
+// to replacement (with regex capture groups substituted in, e.g. "$1").
+func (this *ScrapeConfig) ApplyRelabeling(meta map[string]string) (map[string]string, error) {
+	labels := make(map[string]string, len(meta))
+	for k, v := range meta {
+		labels[k] = v
+	}
+
+	for _, rule := range this.RelabelConfigs {
+		if err := applyRelabelRule(labels, rule); err != nil {
+			return nil, err
+		}
+	}
+
+	return labels, nil
+}
+
+func applyRelabelRule(labels map[string]string, rule RelabelConfig) error {
+	separator := rule.Separator
+	if separator == "" {
+		separator = ";"
+	}
+
+	values := make([]string, len(rule.SourceLabels))
+	for i, label := range rule.SourceLabels {
+		values[i] = labels[label]
+	}
+	source := strings.Join(values, separator)
+
+	regex := rule.Regex
+	if regex == "" {
+		regex = "(.*)"
+	}
+
+	replacement, matched, err := regexpReplace(regex, source, rule.Replacement)
+	if err != nil {
+		return err
+	}
+	if matched && rule.TargetLabel != "" {
+		labels[rule.TargetLabel] = replacement
+	}
+	return nil
+}
+
+// metaLabelsFor builds the __meta_kafka_* labels for a single fetched message, ready to be passed to
+// ApplyRelabeling. When config.UseIncomingTimestamp is false, the message's own embedded timestamp isn't
+// trusted as its reported time, so metaLabelsFor also stamps MetaLabelScrapeTime with the wall-clock time
+// of this fetch, letting a relabel_config promote it in place of the incoming one.
+func metaLabelsFor(config *ScrapeConfig, topic string, partition int32, key []byte, memberID string) map[string]string {
+	labels := map[string]string{
+		MetaLabelTopic:     topic,
+		MetaLabelPartition: fmt.Sprintf("%d", partition),
+		MetaLabelGroupID:   config.GroupID,
+		MetaLabelKey:       string(key),
+		MetaLabelMemberID:  memberID,
+	}
+	if !config.UseIncomingTimestamp {
+		labels[MetaLabelScrapeTime] = time.Now().Format(time.RFC3339Nano)
+	}
+	return labels
+}
+
+// LabelMessage returns a kafka.MessageLabeler that computes this ScrapeConfig's output labels for each
+// fetched message (via metaLabelsFor and ApplyRelabeling) and sets them on msg.Labels. memberID identifies
+// the consumer instance that fetched the message, reported under MetaLabelMemberID. A relabeling error is
+// logged-and-skipped rather than failing the fetch, since a bad regex shouldn't stop consumption.
+//
+// The executor process that actually runs a LowLevelClient is the one that must assign this to
+// kafka.MessageLabeler before fetching, since that global is read per-message from inside that process -
+// setting it here in the scheduler has no effect on the separate executor processes Mesos launches.
+func (this *ScrapeConfig) LabelMessage(memberID string) func(topic string, partition int32, msg *kafka.Message) {
+	return func(topic string, partition int32, msg *kafka.Message) {
+		meta := metaLabelsFor(this, topic, partition, msg.Key, memberID)
+		labels, err := this.ApplyRelabeling(meta)
+		if err != nil {
+			kafka.Errorf(this, "Failed to relabel message from %s:%d: %s", topic, partition, err.Error())
+			return
+		}
+		msg.Labels = labels
+	}
+}